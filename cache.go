@@ -0,0 +1,83 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kaptest
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+)
+
+// ValidatorCache caches Validators by the content of the policy and the options of the CEL environment,
+// so that a policy loaded by many test manifests is compiled only once.
+// It is safe for concurrent use.
+type ValidatorCache struct {
+	mu      sync.Mutex
+	entries map[validatorKey]*validatorEntry
+}
+
+type validatorKey struct {
+	policy     [sha256.Size]byte
+	strictCost bool
+}
+
+type validatorEntry struct {
+	once      sync.Once
+	validator *Validator
+}
+
+// NewValidatorCache returns an empty ValidatorCache.
+func NewValidatorCache() *ValidatorCache {
+	return &ValidatorCache{entries: map[validatorKey]*validatorEntry{}}
+}
+
+// Get returns the Validator of the policy. The policy is compiled when no policy with the same content is cached.
+// Concurrent calls for the same policy wait for a single compilation.
+// A nil ValidatorCache compiles the policy on every call.
+func (c *ValidatorCache) Get(policy *v1.ValidatingAdmissionPolicy) *Validator {
+	if c == nil {
+		return NewValidator(policy)
+	}
+	buf, err := json.Marshal(policy)
+	if err != nil {
+		// Never happens for a valid policy, but compiling it without cache is still correct.
+		return NewValidator(policy)
+	}
+	key := validatorKey{policy: sha256.Sum256(buf), strictCost: strictCost}
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &validatorEntry{}
+		c.entries[key] = e
+	}
+	c.mu.Unlock()
+
+	e.once.Do(func() {
+		e.validator = NewValidator(policy)
+	})
+	return e.validator
+}
+
+// Len returns the number of the cached Validators.
+func (c *ValidatorCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
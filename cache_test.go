@@ -0,0 +1,80 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kaptest
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestValidatorCache_Get(t *testing.T) {
+	cache := NewValidatorCache()
+	got := cache.Get(simplePolicy())
+	if same := cache.Get(simplePolicy()); same != got {
+		t.Errorf("policies with the same content should share the validator")
+	}
+
+	policy := simplePolicy()
+	policy.Spec.Validations[0].Expression = "object.spec.replicas < 10"
+	if other := cache.Get(policy); other == got {
+		t.Errorf("policies with different content should not share the validator")
+	}
+	if cache.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", cache.Len())
+	}
+}
+
+func TestValidatorCache_Get_Nil(t *testing.T) {
+	var cache *ValidatorCache
+	if cache.Get(simplePolicy()) == cache.Get(simplePolicy()) {
+		t.Errorf("a nil cache should compile the policy on every call")
+	}
+}
+
+func TestValidatorCache_Get_Concurrent(t *testing.T) {
+	cache := NewValidatorCache()
+	validators := make([]*Validator, 8)
+	var wg sync.WaitGroup
+	for i := range validators {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			validators[i] = cache.Get(simplePolicy())
+		}()
+	}
+	wg.Wait()
+	for _, v := range validators {
+		if v != validators[0] {
+			t.Fatalf("concurrent calls should return the same validator")
+		}
+	}
+}
+
+func BenchmarkNewValidator(b *testing.B) {
+	policy := simplePolicy()
+	for i := 0; i < b.N; i++ {
+		NewValidator(policy)
+	}
+}
+
+func BenchmarkValidatorCache_Get(b *testing.B) {
+	cache := NewValidatorCache()
+	policy := simplePolicy()
+	for i := 0; i < b.N; i++ {
+		cache.Get(policy)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kaptest
+
+import (
+	"context"
+	"errors"
+
+	celgo "github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types/ref"
+	v1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apiserver/pkg/admission/plugin/cel"
+	celconfig "k8s.io/apiserver/pkg/apis/cel"
+	"k8s.io/apiserver/pkg/cel/environment"
+)
+
+// ExpressionResult is the result of a CEL expression evaluated by EvalExpression.
+type ExpressionResult struct {
+	// Value is the value of the expression. It is nil if Error is set.
+	Value ref.Val
+	// Cost is the runtime cost of the expression including the variables it refers to.
+	Cost int64
+	// Error is set when the expression cannot be compiled or evaluated.
+	Error error
+}
+
+// adhocExpression is a CEL expression of any type.
+type adhocExpression struct {
+	expression string
+}
+
+func (e *adhocExpression) GetExpression() string {
+	return e.expression
+}
+
+func (e *adhocExpression) ReturnTypes() []*celgo.Type {
+	return []*celgo.Type{celgo.AnyType}
+}
+
+// EvalExpression evaluates a CEL expression with the given params in the same environment as the validations of the policy.
+// The variables of the policy are available as `variables`, and `params` is declared if the policy has paramKind.
+// The policy can be nil to evaluate the expression without variables and params.
+func EvalExpression(policy *v1.ValidatingAdmissionPolicy, expression string, p ValidationParams) ExpressionResult {
+	var variables []v1.Variable
+	hasParam := false
+	if policy != nil {
+		variables = policy.Spec.Variables
+		hasParam = policy.Spec.ParamKind != nil
+	}
+	optionalVars := cel.OptionalVariableDeclarations{HasParams: hasParam, HasAuthorizer: true, StrictCost: strictCost}
+	filter := newCompositedCompiler(variables, optionalVars).Compile([]cel.ExpressionAccessor{&adhocExpression{expression: expression}}, optionalVars, environment.StoredExpressions)
+
+	if isNil(p.Object) && isNil(p.OldObject) {
+		return ExpressionResult{Error: errors.New("object or oldObject is required")}
+	}
+	versionedAttr, matchedResource := makeVersionedAttribute(p)
+	if versionedAttr == nil {
+		return ExpressionResult{Error: errors.New("object or oldObject has no name or kind")}
+	}
+	request := cel.CreateAdmissionRequest(versionedAttr.Attributes, metav1.GroupVersionResource(matchedResource), metav1.GroupVersionKind(versionedAttr.VersionedKind))
+	bindings := cel.OptionalVariableBindings{VersionedParams: p.ParamObj, Authorizer: stubAuthz()}
+	results, remaining, err := filter.ForInput(context.Background(), versionedAttr, request, bindings, p.NamespaceObj, celconfig.RuntimeCELCostBudget)
+	if err != nil {
+		return ExpressionResult{Error: err}
+	}
+	cost := celconfig.RuntimeCELCostBudget - remaining
+	if results[0].Error != nil {
+		return ExpressionResult{Cost: cost, Error: results[0].Error}
+	}
+	return ExpressionResult{Value: results[0].EvalResult, Cost: cost}
+}
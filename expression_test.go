@@ -0,0 +1,70 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kaptest
+
+import (
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+)
+
+func TestEvalExpression(t *testing.T) {
+	policy := simplePolicy()
+	policy.Spec.Variables = []v1.Variable{{Name: "replicas", Expression: "object.spec.replicas"}}
+	params := ValidationParams{Object: simpleDeployment(withReplicas(3))}
+	cases := []struct {
+		name       string
+		policy     *v1.ValidatingAdmissionPolicy
+		expression string
+		params     ValidationParams
+		want       any
+		wantType   string
+		wantErr    string
+	}{
+		{name: "ok: object", expression: "object.metadata.name", params: params, want: "simpleDeployment", wantType: "string"},
+		{name: "ok: variables", policy: policy, expression: "variables.replicas * 2", params: params, want: int64(6), wantType: "int"},
+		{name: "ok: request", expression: "request.operation", params: params, want: "CREATE", wantType: "string"},
+		{name: "ok: oldObject", expression: "oldObject == null", params: params, want: true, wantType: "bool"},
+		{name: "err: undefined variables", expression: "variables.replicas", params: params, wantErr: "undefined field"},
+		{name: "err: syntax", expression: "object.", params: params, wantErr: "Syntax error"},
+		{name: "err: no object", expression: "1", wantErr: "object or oldObject is required"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := EvalExpression(tc.policy, tc.expression, tc.params)
+			if tc.wantErr != "" {
+				if got.Error == nil || !strings.Contains(got.Error.Error(), tc.wantErr) {
+					t.Fatalf("EvalExpression() error = %v, want %q", got.Error, tc.wantErr)
+				}
+				return
+			}
+			if got.Error != nil {
+				t.Fatalf("EvalExpression() error = %v", got.Error)
+			}
+			if got.Value.Value() != tc.want {
+				t.Errorf("EvalExpression() = %v, want %v", got.Value.Value(), tc.want)
+			}
+			if typeName := got.Value.Type().TypeName(); typeName != tc.wantType {
+				t.Errorf("EvalExpression() type = %s, want %s", typeName, tc.wantType)
+			}
+			if got.Cost <= 0 {
+				t.Errorf("EvalExpression() cost = %d, want positive", got.Cost)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pfnet/kaptest/tester"
+	"github.com/spf13/cobra"
+)
+
+func newAffectedCmd(cfg *tester.CmdConfig) *cobra.Command {
+	// changedSince has its own variable since its default differs from the flag of the run command.
+	var changedSince string
+	cmd := &cobra.Command{
+		Use:   "affected [path to test manifest or directory]...",
+		Short: "Print the test manifests affected by the files changed in git",
+		Long: `Print the test manifests affected by the files changed since the git ref.
+
+A test manifest is affected when the manifest itself or the policy and resource files it loads
+are changed, including uncommitted and untracked files. Paths are resolved in the same way as "kaptest run".`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return fmt.Errorf("path is required")
+			}
+			c := *cfg
+			c.ChangedSince = changedSince
+			return tester.RunAffected(c, args)
+		},
+	}
+	cmd.Flags().StringVar(&changedSince, "changed-since", "HEAD", "Git ref to compare the files with (e.g. origin/main)")
+	cmd.Flags().StringVar(&cfg.ManifestPattern, "manifest-pattern", tester.DefaultManifestPattern, "Glob pattern of test manifests to discover in directories, matched against the paths relative to each searched directory")
+	cmd.Flags().StringSliceVar(&cfg.Ignore, "ignore", nil, "Glob patterns of files and directories to skip in the discovery, matched against the paths relative to each searched directory")
+	return cmd
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pfnet/kaptest/tester"
+	"github.com/spf13/cobra"
+)
+
+func newEvalCmd() *cobra.Command {
+	var opts tester.EvalOptions
+	var output string
+	cmd := &cobra.Command{
+		Use:   "eval [path to object]",
+		Short: "Evaluate policies against an object without test manifests",
+		Long: `Evaluate ValidatingAdmissionPolicies against an object and print the decisions.
+
+The object is read from stdin when the path is "-" (e.g. "kubectl get deploy foo -o yaml | kaptest eval -p policy.yaml -").
+The operation is determined in the same way as test manifests: CREATE with an object, UPDATE with --old-object
+in addition, and DELETE with only --old-object.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(opts.Policies) == 0 {
+				return fmt.Errorf("--policy is required")
+			}
+			if len(args) > 0 {
+				opts.Object = args[0]
+			}
+			opts.Output = tester.OutputFormat(output)
+			return tester.RunEval(opts)
+		},
+	}
+	cmd.Flags().StringSliceVarP(&opts.Policies, "policy", "p", nil, "Files, directories or glob patterns of the ValidatingAdmissionPolicies to evaluate. Can be specified multiple times")
+	cmd.Flags().StringVar(&opts.OldObject, "old-object", "", `Path to the old object. "-" reads it from stdin`)
+	cmd.Flags().StringVar(&opts.Params, "params", "", "Path to the param object for the policies with paramKind")
+	cmd.Flags().StringVar(&opts.Namespace, "namespace", "", "Path to the Namespace object of the object. A Namespace without labels is used if omitted")
+	cmd.Flags().StringVar(&opts.UserInfo.Name, "user", "", "Name of the user who sends the request")
+	cmd.Flags().StringSliceVar(&opts.UserInfo.Groups, "groups", nil, "Groups of the user who sends the request")
+	cmd.Flags().StringVarP(&output, "output", "o", string(tester.OutputText), "Output format (text, json)")
+	return cmd
+}
@@ -19,7 +19,7 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/pfnet/kaptest/internal/tester"
+	"github.com/pfnet/kaptest/tester"
 	"github.com/spf13/cobra"
 )
 
@@ -0,0 +1,41 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/pfnet/kaptest/tester"
+	"github.com/spf13/cobra"
+)
+
+func newREPLCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "repl [path to test manifest]",
+		Short: "Evaluate CEL expressions interactively against the resources of a test manifest",
+		Long: `Evaluate CEL expressions interactively in the same environment as the validations of policies.
+
+The policies and resources of the test manifest are loaded, and the context of the first test case is selected.
+Type ":help" in the REPL for the commands to change the context.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifestPath := ""
+			if len(args) > 0 {
+				manifestPath = args[0]
+			}
+			return tester.RunREPL(manifestPath)
+		},
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pfnet/kaptest/tester"
+	"github.com/spf13/cobra"
+)
+
+func newReplayCmd() *cobra.Command {
+	var opts tester.ReplayOptions
+	var output string
+	cmd := &cobra.Command{
+		Use:   "replay",
+		Short: "Replay the requests in an audit log against policies",
+		Long: `Replay the mutating requests recorded in a Kubernetes audit log against ValidatingAdmissionPolicies
+to predict which requests the policies would deny before rolling them out.
+
+The audit log must be in JSON lines at the RequestResponse level ("-" reads it from stdin).
+The old object of UPDATE and DELETE requests is the latest state of the object recorded earlier in the log,
+so requests to objects which have not been seen are skipped.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(opts.Policies) == 0 {
+				return fmt.Errorf("--policy is required")
+			}
+			if opts.AuditLog == "" {
+				return fmt.Errorf("--audit-log is required")
+			}
+			opts.Output = tester.OutputFormat(output)
+			return tester.RunReplay(opts)
+		},
+	}
+	cmd.Flags().StringSliceVarP(&opts.Policies, "policy", "p", nil, "Files, directories or glob patterns of the ValidatingAdmissionPolicies to evaluate. Can be specified multiple times")
+	cmd.Flags().StringSliceVarP(&opts.Resources, "resources", "r", nil, "Files, directories or glob patterns of the bindings, params and namespaces. Can be specified multiple times")
+	cmd.Flags().StringVar(&opts.AuditLog, "audit-log", "", `Path to the audit log in JSON lines. "-" reads it from stdin`)
+	cmd.Flags().IntVar(&opts.Samples, "samples", 5, "Maximum number of the sample denials shown for each policy")
+	cmd.Flags().BoolVar(&opts.StrictNamespaces, "strict-namespaces", false, "Report the requests in Namespaces not in the resources as errors instead of using Namespaces without labels and annotations")
+	cmd.Flags().StringVarP(&output, "output", "o", string(tester.OutputText), "Output format (text, json)")
+	return cmd
+}
@@ -20,7 +20,7 @@ import (
 	"log/slog"
 	"os"
 
-	"github.com/pfnet/kaptest/internal/tester"
+	"github.com/pfnet/kaptest/tester"
 	"github.com/spf13/cobra"
 )
 
@@ -47,6 +47,11 @@ func newRootCmd() *cobra.Command {
 
 	cmd.AddCommand(newInitCmd(&cfg))
 	cmd.AddCommand(newRunCmd(&cfg))
+	cmd.AddCommand(newAffectedCmd(&cfg))
+	cmd.AddCommand(newEvalCmd())
+	cmd.AddCommand(newREPLCmd())
+	cmd.AddCommand(newReplayCmd())
+	cmd.AddCommand(newScanCmd())
 	cmd.AddCommand(newVersionCmd())
 	return cmd
 }
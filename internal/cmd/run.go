@@ -18,20 +18,48 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"os/signal"
 
-	"github.com/pfnet/kaptest/internal/tester"
+	"github.com/pfnet/kaptest/tester"
 	"github.com/spf13/cobra"
 )
 
 func newRunCmd(cfg *tester.CmdConfig) *cobra.Command {
-	return &cobra.Command{
-		Use:   "run [path to test manifest]...",
+	cmd := &cobra.Command{
+		Use:   "run [path to test manifest or directory]...",
 		Short: "Run the tests of ValidatingAdmissionPolicy",
+		Long: `Run the tests of ValidatingAdmissionPolicy.
+
+A directory or a path ending with "/..." (e.g. "./...") is searched recursively for test manifests
+matching --manifest-pattern. Policies found in the searched directories without tests are reported.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if len(args) == 0 {
 				return fmt.Errorf("path is required")
 			}
+			if cfg.Watch {
+				if cfg.Update || cfg.UpdateSnapshots {
+					return fmt.Errorf("--update and --update-snapshots cannot be used with --watch")
+				}
+				ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+				defer stop()
+				return tester.Watch(ctx, *cfg, args)
+			}
 			return tester.Run(*cfg, args)
 		},
 	}
+	cmd.Flags().StringVar(&cfg.ManifestPattern, "manifest-pattern", tester.DefaultManifestPattern, "Glob pattern of test manifests to discover in directories, matched against the paths relative to each searched directory")
+	cmd.Flags().StringSliceVar(&cfg.Ignore, "ignore", nil, "Glob patterns of files and directories to skip in the discovery, matched against the paths relative to each searched directory")
+	cmd.Flags().IntVarP(&cfg.Parallelism, "jobs", "j", 1, "Number of test manifests and test cases run in parallel. The results are written in the order of the manifests")
+	cmd.Flags().StringVar(&cfg.ChangedSince, "changed-since", "", "Run only the test manifests affected by the files changed since the git ref (e.g. origin/main). Cannot be used with --watch")
+	cmd.Flags().BoolVarP(&cfg.Watch, "watch", "w", false, "Re-run the test manifests affected by changes of the manifests, policies and resources until interrupted")
+	cmd.Flags().DurationVar(&cfg.WatchInterval, "watch-interval", tester.DefaultWatchInterval, "Interval to check the changes of the files in the watch mode")
+	cmd.Flags().BoolVar(&cfg.Update, "update", false, "Rewrite the expectations of the failed test cases in the test manifests to their results")
+	cmd.Flags().BoolVar(&cfg.UpdateSnapshots, "update-snapshots", false, "Rewrite the snapshot files of the test manifests with the results of the test cases opting into snapshots")
+	cmd.Flags().BoolVar(&cfg.WarningsAsErrors, "warnings-as-errors", false, "Fail the tests of a manifest when loading its policies and resources has warnings, e.g. duplicate definitions")
+	cmd.Flags().BoolVar(&cfg.ApplyDefaults, "apply-defaults", false, "Apply the defaults of the API server, e.g. spec.replicas of Deployments, to the built-in objects in the resources before evaluating them")
+	cmd.Flags().BoolVar(&cfg.ValidateFixtures, "validate-fixtures", false, "Fail the test cases using built-in objects in the resources which are invalid against the Kubernetes API, e.g. a string in an integer field")
+	cmd.Flags().BoolVar(&cfg.StrictNamespaces, "strict-namespaces", false, "Fail the test cases whose objects are in Namespaces not in the resources instead of using Namespaces without labels and annotations")
+	cmd.Flags().StringSliceVarP(&cfg.Outputs, "output", "o", nil, `Output format of the test results in the form of "format[=path]" (text, json, junit, tap, github, sarif). Can be specified multiple times. The results are written to stdout when the path is omitted`)
+	return cmd
 }
@@ -0,0 +1,56 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/pfnet/kaptest/tester"
+	"github.com/spf13/cobra"
+)
+
+func newScanCmd() *cobra.Command {
+	var opts tester.ScanOptions
+	var output string
+	cmd := &cobra.Command{
+		Use:   "scan [path to dump]...",
+		Short: "Scan exported objects for violations of policies",
+		Long: `Evaluate ValidatingAdmissionPolicies against the objects exported from a cluster
+(e.g. "kubectl get deploy,sts -A -o yaml > dump.yaml") and report the objects violating the policies.
+
+Each object is evaluated as a CREATE request, or an UPDATE request against itself with --operation UPDATE.
+Lists are unpacked, and the namespaces, bindings and params are looked up from the dumps and --resources.
+It exits with a non-zero status if any object violates the policies.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(opts.Policies) == 0 {
+				return fmt.Errorf("--policy is required")
+			}
+			opts.Dumps = args
+			opts.Output = tester.OutputFormat(output)
+			return tester.RunScan(opts)
+		},
+	}
+	cmd.Flags().StringSliceVarP(&opts.Policies, "policy", "p", nil, "Files, directories or glob patterns of the ValidatingAdmissionPolicies to evaluate. Can be specified multiple times")
+	cmd.Flags().StringSliceVarP(&opts.Resources, "resources", "r", nil, "Files, directories or glob patterns of the bindings, params and namespaces. Can be specified multiple times")
+	cmd.Flags().StringVar(&opts.Operation, "operation", "CREATE", "Operation of the requests (CREATE, UPDATE)")
+	cmd.Flags().StringVar(&opts.UserInfo.Name, "user", "", "Name of the user who sends the requests")
+	cmd.Flags().StringSliceVar(&opts.UserInfo.Groups, "groups", nil, "Groups of the user who sends the requests")
+	cmd.Flags().BoolVar(&opts.StrictNamespaces, "strict-namespaces", false, "Report the objects in Namespaces not in the dumps nor the resources as errors instead of using Namespaces without labels and annotations")
+	cmd.Flags().StringVarP(&output, "output", "o", string(tester.OutputText), "Output format (text, json)")
+	return cmd
+}
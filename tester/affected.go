@@ -0,0 +1,208 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// RunAffected prints the test manifests affected by the files changed since cfg.ChangedSince.
+func RunAffected(cfg CmdConfig, pathList []string) error {
+	manifests, _, err := resolveManifests(Options{ManifestPattern: cfg.ManifestPattern, Ignore: cfg.Ignore}, pathList)
+	if err != nil {
+		return err
+	}
+	affected, err := AffectedManifests(manifests, cfg.ChangedSince)
+	if err != nil {
+		return err
+	}
+	for _, m := range affected {
+		fmt.Println(m)
+	}
+	return nil
+}
+
+// AffectedManifests returns the test manifests which depend on the files changed since the git ref.
+// A manifest depends on itself and the policy and resource files it loads.
+// The changes are read from the git repository of the working directory, including
+// uncommitted and untracked files. The ref is compared at its merge base with HEAD
+// so that the changes made only on the ref are not included.
+func AffectedManifests(manifests []string, ref string) ([]string, error) {
+	changed, err := gitChangedFiles(".", ref)
+	if err != nil {
+		return nil, err
+	}
+	return newDependencyGraph(manifests).affected(changed), nil
+}
+
+// dependencyGraph is the files which each test manifest depends on.
+type dependencyGraph struct {
+	manifests []string
+	// files is the absolute paths of the files and the directories keyed by manifest.
+	// They include the files which do not exist so that deleting them affects the manifest.
+	files map[string][]string
+	// patterns is the absolute glob patterns keyed by manifest.
+	patterns map[string][]string
+}
+
+func newDependencyGraph(manifests []string) dependencyGraph {
+	g := dependencyGraph{manifests: manifests, files: map[string][]string{}, patterns: map[string][]string{}}
+	for _, m := range manifests {
+		files, patterns := manifestDependencies(m)
+		for _, f := range append([]string{m, snapshotPath(m)}, files...) {
+			g.files[m] = append(g.files[m], absPath(f))
+		}
+		for _, p := range patterns {
+			g.patterns[m] = append(g.patterns[m], absPath(p))
+		}
+	}
+	return g
+}
+
+// affected returns the manifests depending on any of the changed files in the order of the manifests.
+func (g dependencyGraph) affected(changed []string) []string {
+	var out []string
+	for _, m := range g.manifests {
+		for _, f := range changed {
+			if g.dependsOn(m, absPath(f)) {
+				out = append(out, m)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// dependsOn reports whether the manifest loads the file, which may have been deleted.
+// A file directly under a loaded directory and a file matching a loaded glob pattern are loaded as well.
+func (g dependencyGraph) dependsOn(manifest, file string) bool {
+	for _, f := range g.files[manifest] {
+		if file == f || (filepath.Dir(file) == f && hasManifestExt(file)) {
+			return true
+		}
+	}
+	for _, p := range g.patterns[manifest] {
+		if matchPattern(splitPath(p), splitPath(file)) {
+			return true
+		}
+	}
+	return false
+}
+
+// manifestFiles returns the manifest, its snapshot file and the existing policy, resource and AdmissionReview files it loads.
+// Files which cannot be resolved are omitted since the errors are reported by running the manifest.
+func manifestFiles(manifestPath string) []string {
+	files := []string{manifestPath, snapshotPath(manifestPath)}
+	paths, patterns := manifestDependencies(manifestPath)
+	for _, p := range append(paths, patterns...) {
+		matched, err := expandPath(p)
+		if err != nil {
+			continue
+		}
+		files = append(files, matched...)
+	}
+	return files
+}
+
+// manifestDependencies returns the paths of the policies, the resources and the AdmissionReviews which the manifest loads,
+// split into the paths of the files or the directories and the glob patterns.
+// The paths are resolved from the manifest without checking whether they exist.
+func manifestDependencies(manifestPath string) (paths, patterns []string) {
+	buf, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, nil
+	}
+	var manifests TestManifests
+	if err := yaml.Unmarshal(buf, &manifests); err != nil {
+		return nil, nil
+	}
+	baseDir := filepath.Dir(manifestPath)
+	deps := append(resolvePaths(baseDir, manifests.ValidatingAdmissionPolicies), resolvePaths(baseDir, manifests.Resources)...)
+	for _, s := range manifests.TestSuites {
+		for _, tc := range s.Tests {
+			if tc.AdmissionReview != "" {
+				deps = append(deps, resolvePaths(baseDir, []string{tc.AdmissionReview})...)
+			}
+		}
+	}
+	for _, p := range deps {
+		if hasMeta(p) {
+			patterns = append(patterns, p)
+		} else {
+			paths = append(paths, p)
+		}
+	}
+	return paths, patterns
+}
+
+// gitChangedFiles returns the files changed since the merge base of the ref and HEAD in the repository of dir.
+// The paths are joined with dir. Deleted files are included since the manifests loading them are affected,
+// and a renamed file is reported by both its old and new paths for the same reason.
+func gitChangedFiles(dir, ref string) ([]string, error) {
+	base, err := git(dir, "merge-base", ref, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := git(dir, "rev-parse", "--show-prefix")
+	if err != nil {
+		return nil, err
+	}
+	diff, err := git(dir, "diff", "--name-only", "--no-renames", "-z", strings.TrimSpace(string(base)))
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(dir, "ls-files", "--others", "--exclude-standard", "--full-name", "-z", ":/")
+	if err != nil {
+		return nil, err
+	}
+
+	// git prints the paths relative to the top of the repository.
+	prefixDir := strings.TrimSpace(string(prefix))
+	var files []string
+	for _, out := range [][]byte{diff, untracked} {
+		for _, p := range bytes.Split(out, []byte{0}) {
+			if len(p) == 0 {
+				continue
+			}
+			rel, err := filepath.Rel(filepath.FromSlash(prefixDir), filepath.FromSlash(string(p)))
+			if err != nil {
+				continue
+			}
+			files = append(files, filepath.Join(dir, rel))
+		}
+	}
+	return files, nil
+}
+
+func git(dir string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
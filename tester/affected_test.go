@@ -0,0 +1,159 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDependencyGraph_Affected(t *testing.T) {
+	t.Parallel()
+	manifests := []string{
+		"testdata/vap-standard-resources.test/kaptest.yaml",
+		"testdata/vap-standard-resources.test/invalid-no-obj.yaml",
+		"testdata/vap-with-params.test/kaptest.yaml",
+		"testdata/invalid-format.yaml",
+		"testdata/vap-with-admission-review.test/kaptest.yaml",
+	}
+	g := newDependencyGraph(manifests)
+	tests := []struct {
+		name    string
+		changed []string
+		want    []string
+	}{
+		{
+			name:    "ok: policy file",
+			changed: []string{"testdata/vap-standard-resources.yaml"},
+			want:    manifests[:2],
+		},
+		{
+			name:    "ok: resource file",
+			changed: []string{"testdata/vap-with-params.test/resources.yaml"},
+			want:    manifests[2:3],
+		},
+		{
+			name:    "ok: manifest itself",
+			changed: []string{"testdata/invalid-format.yaml", "README.md"},
+			want:    manifests[3:4],
+		},
+		{
+			name:    "ok: AdmissionReview file",
+			changed: []string{"testdata/vap-with-admission-review.test/delete.yaml"},
+			want:    manifests[4:],
+		},
+		{
+			name:    "ok: unrelated file",
+			changed: []string{"testdata/vap-with-userinfo.yaml"},
+			want:    nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := g.affected(tt.changed); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("affected() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDependencyGraph_Affected_Deleted(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	copyTestdata(t, dir,
+		"vap-standard-resources.yaml",
+		"vap-standard-resources.test/kaptest.yaml",
+		"vap-standard-resources.test/resources.yaml",
+		"vap-with-params.yaml",
+		"vap-with-params.test/kaptest.yaml",
+		"vap-with-params.test/resources.yaml",
+	)
+	manifests := []string{
+		filepath.Join(dir, "vap-standard-resources.test/kaptest.yaml"),
+		filepath.Join(dir, "vap-with-params.test/kaptest.yaml"),
+	}
+	// The second manifest loads the resources by a glob pattern.
+	touch(t, manifests[1], strings.NewReplacer("- resources.yaml", "- '*.yaml'"))
+	deleted := []string{
+		filepath.Join(dir, "vap-standard-resources.test/resources.yaml"),
+		filepath.Join(dir, "vap-with-params.test/resources.yaml"),
+	}
+	for _, f := range deleted {
+		mustNil(t, os.Remove(f))
+	}
+
+	g := newDependencyGraph(manifests)
+	for i, f := range deleted {
+		if got := g.affected([]string{f}); !reflect.DeepEqual(got, manifests[i:i+1]) {
+			t.Errorf("affected(%s) = %v, want %v", f, got, manifests[i:i+1])
+		}
+	}
+}
+
+func TestGitChangedFiles(t *testing.T) {
+	t.Parallel()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		if _, err := git(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copyTestdata(t, dir,
+		"vap-standard-resources.yaml",
+		"vap-standard-resources.test/kaptest.yaml",
+		"vap-standard-resources.test/resources.yaml",
+	)
+	run("init", "-q", "-b", "main")
+	run("add", "-A")
+	run("commit", "-q", "-m", "init")
+	run("checkout", "-q", "-b", "feature")
+
+	mustNil(t, os.WriteFile(filepath.Join(dir, "vap-standard-resources.yaml"), []byte("# changed\n"), 0o644))
+	mustNil(t, os.Remove(filepath.Join(dir, "vap-standard-resources.test", "resources.yaml")))
+	mustNil(t, os.WriteFile(filepath.Join(dir, "vap-standard-resources.test", "new.yaml"), nil, 0o644))
+	run("mv", "vap-standard-resources.test/kaptest.yaml", "vap-standard-resources.test/moved.yaml")
+
+	// Paths are relative to the given directory even if it is a subdirectory of the repository.
+	sub := filepath.Join(dir, "vap-standard-resources.test")
+	got, err := gitChangedFiles(sub, "main")
+	mustNil(t, err)
+	sort.Strings(got)
+	want := []string{
+		filepath.Join(sub, "..", "vap-standard-resources.yaml"),
+		filepath.Join(sub, "kaptest.yaml"),
+		filepath.Join(sub, "moved.yaml"),
+		filepath.Join(sub, "new.yaml"),
+		filepath.Join(sub, "resources.yaml"),
+	}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("gitChangedFiles() = %v, want %v", got, want)
+	}
+
+	if _, err := gitChangedFiles(dir, "not-found"); err == nil {
+		t.Errorf("gitChangedFiles() error = nil, want error for unknown ref")
+	}
+}
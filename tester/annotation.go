@@ -0,0 +1,250 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Rules of the annotations on source files.
+const (
+	ruleManifestError  = "manifest-error"
+	ruleTestFailure    = "test-failure"
+	rulePolicyFailure  = "policy-expression"
+	ruleUntestedPolicy = "untested-policy"
+	ruleLoadIssue      = "load-issue"
+)
+
+var annotationRules = []struct {
+	id          string
+	description string
+}{
+	{id: ruleManifestError, description: "The test manifest cannot be run"},
+	{id: ruleTestFailure, description: "The test case does not get the expected result"},
+	{id: rulePolicyFailure, description: "The CEL expression in the policy denied or failed in a failed test case"},
+	{id: ruleUntestedPolicy, description: "The policy has no tests"},
+	{id: ruleLoadIssue, description: "The policy or resource file has a problem found while loading it"},
+}
+
+// annotation is a message attached to a location in a source file.
+type annotation struct {
+	rule string
+	// level is one of error, warning and notice.
+	level    string
+	title    string
+	message  string
+	position Position
+}
+
+// collectAnnotations converts the failures in the report into annotations.
+// Failed test cases are attached to the test manifests, and the expressions which denied or failed
+// in those cases are attached to the policy files. Identical annotations are reported only once.
+func collectAnnotations(r Report) []annotation {
+	var out []annotation
+	seen := map[annotation]struct{}{}
+	add := func(a annotation) {
+		if _, ok := seen[a]; ok {
+			return
+		}
+		seen[a] = struct{}{}
+		out = append(out, a)
+	}
+	positionOr := func(p *Position, file string) Position {
+		if p != nil {
+			return *p
+		}
+		return Position{File: file}
+	}
+
+	for _, m := range r.Manifests {
+		for _, i := range m.LoadIssues {
+			message := i.Message
+			if i.Document > 0 {
+				message = fmt.Sprintf("document %d: %s", i.Document, message)
+			}
+			add(annotation{rule: ruleLoadIssue, level: string(i.Severity), title: "kaptest", message: message, position: Position{File: i.Path}})
+		}
+		if m.Error != "" {
+			add(annotation{rule: ruleManifestError, level: "error", title: "kaptest", message: m.Error, position: Position{File: m.Path}})
+			continue
+		}
+		for _, s := range m.Suites {
+			if s.Error != "" {
+				add(annotation{rule: ruleManifestError, level: "error", title: "kaptest: " + s.Policy, message: s.Error, position: positionOr(s.Position, m.Path)})
+				continue
+			}
+			for _, c := range s.Cases {
+				if c.Pass {
+					continue
+				}
+				title := fmt.Sprintf("kaptest: %s - %s", s.Policy, c.Name)
+				message := fmt.Sprintf("%s ==> %s", strings.ToUpper(string(c.Expect)), resultLabel(c.Result))
+				if details := caseDetails(c); details != "" {
+					message += "\n" + details
+				}
+				add(annotation{rule: ruleTestFailure, level: "error", title: title, message: message, position: positionOr(c.Position, m.Path)})
+
+				for _, d := range c.Decisions {
+					if d.Position == nil {
+						continue
+					}
+					level := "warning"
+					if d.Evaluation == ResultError {
+						level = "error"
+					}
+					add(annotation{rule: rulePolicyFailure, level: level, title: "kaptest: " + s.Policy, message: fmt.Sprintf("%s: %s", resultLabel(d.Evaluation), d.Message), position: *d.Position})
+				}
+				if c.ExpressionPosition != nil {
+					add(annotation{rule: rulePolicyFailure, level: "error", title: "kaptest: " + s.Policy, message: "ERROR: " + strings.Join(c.Errors, "\n"), position: *c.ExpressionPosition})
+				}
+			}
+		}
+	}
+	for _, p := range r.UntestedPolicies {
+		add(annotation{rule: ruleUntestedPolicy, level: "warning", title: "kaptest", message: fmt.Sprintf("policy %q has no tests", p.Name), position: Position{File: p.Path}})
+	}
+	return out
+}
+
+// writeGitHubActions writes the annotations as GitHub Actions workflow commands.
+// See https://docs.github.com/en/actions/using-workflows/workflow-commands-for-github-actions
+func writeGitHubActions(w io.Writer, r Report) error {
+	var b strings.Builder
+	for _, a := range collectAnnotations(r) {
+		props := []string{"file=" + escapeGitHubProperty(annotationPath(a.position.File))}
+		if a.position.Line > 0 {
+			props = append(props, fmt.Sprintf("line=%d", a.position.Line))
+		}
+		if a.position.Column > 0 {
+			props = append(props, fmt.Sprintf("col=%d", a.position.Column))
+		}
+		props = append(props, "title="+escapeGitHubProperty(a.title))
+		fmt.Fprintf(&b, "::%s %s::%s\n", a.level, strings.Join(props, ","), escapeGitHubData(a.message))
+	}
+	fmt.Fprintf(&b, "Total: %d, Pass: %d, Fail: %d\n", r.Total, r.Pass, r.Fail)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// annotationPath returns the file path in the form used by the annotations, e.g. "dir/file.yaml".
+func annotationPath(file string) string {
+	return filepath.ToSlash(filepath.Clean(file))
+}
+
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+// writeSARIF writes the annotations in SARIF 2.1.0.
+func writeSARIF(w io.Writer, r Report) error {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "kaptest",
+			InformationURI: "https://github.com/pfnet/kaptest",
+		}},
+		Results: []sarifResult{},
+	}
+	for _, rule := range annotationRules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: rule.id, ShortDescription: sarifMessage{Text: rule.description}})
+	}
+	for _, a := range collectAnnotations(r) {
+		loc := sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: annotationPath(a.position.File)}}
+		if a.position.Line > 0 {
+			loc.Region = &sarifRegion{StartLine: a.position.Line, StartColumn: a.position.Column}
+		}
+		level := a.level
+		if level == "notice" {
+			level = "note"
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID:    a.rule,
+			Level:     level,
+			Message:   sarifMessage{Text: a.title + "\n" + a.message},
+			Locations: []sarifLocation{{PhysicalLocation: loc}},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
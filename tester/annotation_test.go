@@ -0,0 +1,98 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRun_Annotations(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	githubPath := filepath.Join(dir, "github.txt")
+	sarifPath := filepath.Join(dir, "out.sarif")
+	cfg := CmdConfig{Outputs: []string{"github=" + githubPath, "sarif=" + sarifPath}}
+	err := Run(cfg, []string{
+		"./testdata/vap-with-namespaces.test/invalid-no-namespace.yaml",
+		"./testdata/invalid-format.yaml",
+	})
+	if err != ErrTestFail {
+		t.Fatalf("Run() = %v, want %v", err, ErrTestFail)
+	}
+
+	buf, err := os.ReadFile(githubPath)
+	mustNil(t, err)
+	for _, want := range []string{
+		"::error file=testdata/vap-with-namespaces.test/invalid-no-namespace.yaml,line=8,col=5,title=kaptest%3A deployment-replicas - (CREATE) Deployment%3Anot-exist/ok::ADMIT ==> DENY%0A",
+		"::warning file=testdata/vap-with-namespaces.yaml,line=19,col=17,title=kaptest%3A deployment-replicas::DENY: ",
+		"::error file=testdata/invalid-format.yaml,title=kaptest::",
+	} {
+		if !strings.Contains(string(buf), want) {
+			t.Errorf("github output does not contain %q:\n%s", want, buf)
+		}
+	}
+
+	buf, err = os.ReadFile(sarifPath)
+	mustNil(t, err)
+	var log sarifLog
+	mustNil(t, json.Unmarshal(buf, &log))
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) != 3 {
+		t.Fatalf("unexpected sarif output: %s", buf)
+	}
+	got := log.Runs[0].Results[1]
+	loc := got.Locations[0].PhysicalLocation
+	if got.RuleID != rulePolicyFailure || loc.ArtifactLocation.URI != "testdata/vap-with-namespaces.yaml" || loc.Region == nil || loc.Region.StartLine != 19 {
+		t.Errorf("unexpected sarif result: %+v", got)
+	}
+	if got := log.Runs[0].Results[2]; got.RuleID != ruleManifestError || got.Locations[0].PhysicalLocation.Region != nil {
+		t.Errorf("unexpected sarif result: %+v", got)
+	}
+}
+
+func TestEscapeGitHub(t *testing.T) {
+	t.Parallel()
+	if got, want := escapeGitHubData("100%\r\nok: a,b"), "100%25%0D%0Aok: a,b"; got != want {
+		t.Errorf("escapeGitHubData() = %q, want %q", got, want)
+	}
+	if got, want := escapeGitHubProperty("100%\r\nok: a,b"), "100%25%0D%0Aok%3A a%2Cb"; got != want {
+		t.Errorf("escapeGitHubProperty() = %q, want %q", got, want)
+	}
+}
+
+func TestCollectAnnotations_LoadIssues(t *testing.T) {
+	t.Parallel()
+	got := collectAnnotations(Report{Manifests: []ManifestReport{{
+		Path: "kaptest.yaml",
+		LoadIssues: []LoadIssue{
+			{Severity: LoadIssueWarning, Path: "resources.yaml", Document: 2, Message: "duplicate"},
+			{Severity: LoadIssueError, Path: "policy.yaml", Message: "read file"},
+		},
+		Suites: []SuiteReport{},
+	}}})
+	want := []annotation{
+		{rule: ruleLoadIssue, level: "warning", title: "kaptest", message: "document 2: duplicate", position: Position{File: "resources.yaml"}},
+		{rule: ruleLoadIssue, level: "error", title: "kaptest", message: "read file", position: Position{File: "policy.yaml"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("collectAnnotations() = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// largeSuiteManifests is the number of test manifests generated by newLargeSuite.
+const largeSuiteManifests = 50
+
+// newLargeSuite generates test manifests which share the same policy file and returns the directory.
+func newLargeSuite(b *testing.B) string {
+	b.Helper()
+	dir := b.TempDir()
+	for _, name := range []string{"vap-standard-resources.yaml", "vap-standard-resources.test/resources.yaml"} {
+		buf, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), buf, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	manifest, err := os.ReadFile("testdata/vap-standard-resources.test/kaptest.yaml")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < largeSuiteManifests; i++ {
+		path := filepath.Join(dir, "vap-standard-resources.test", fmt.Sprintf("kaptest-%02d.yaml", i))
+		if err := os.WriteFile(path, manifest, 0o644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// BenchmarkRunner_Run compares the runs with the validator cache against the runs compiling the policy for each manifest.
+func BenchmarkRunner_Run(b *testing.B) {
+	dir := newLargeSuite(b)
+	pattern := "**/*.test/kaptest-*.yaml"
+	for _, cache := range []bool{true, false} {
+		for _, parallelism := range []int{1, 4} {
+			b.Run(fmt.Sprintf("cache=%t/parallelism=%d", cache, parallelism), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					runner := NewRunner(Options{ManifestPattern: pattern, Parallelism: parallelism})
+					if !cache {
+						runner.validators = nil
+					}
+					report, err := runner.Run([]string{dir})
+					if err != nil {
+						b.Fatal(err)
+					}
+					if report.Fail > 0 {
+						b.Fatalf("unexpected failures: %d", report.Fail)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkResourceLoader_GetResource(b *testing.B) {
+	loader := NewResourceLoader()
+	const n = 5000
+	for i := 0; i < n; i++ {
+		loader.AddResource(newUnstructured("apps/v1", "Deployment", fmt.Sprintf("ns-%d", i%10), fmt.Sprintf("deploy-%d", i)))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		query := NameWithGVK{GVK: GVK{Kind: "Deployment"}, NamespacedName: NamespacedName{Name: fmt.Sprintf("deploy-%d", i%n)}}
+		if obj, err := loader.GetResource(query); err != nil || obj == nil {
+			b.Fatalf("GetResource() = %v, %v", obj, err)
+		}
+	}
+}
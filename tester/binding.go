@@ -0,0 +1,440 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/pfnet/kaptest"
+	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/admission/plugin/webhook/predicates/rules"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// policyTarget is a policy with one of its bindings.
+// The binding is nil if no binding of the policy is loaded, in which case the policy applies to all the requests it matches.
+type policyTarget struct {
+	vap       *v1.ValidatingAdmissionPolicy
+	binding   *v1.ValidatingAdmissionPolicyBinding
+	validator *kaptest.Validator
+}
+
+func (t policyTarget) bindingName() string {
+	if t.binding == nil {
+		return ""
+	}
+	return t.binding.Name
+}
+
+// validationActions returns the actions taken on the requests failing the validations.
+// The requests are denied if no binding is loaded, or if the binding has no validationActions,
+// which the API server rejects, so that the failures are not silently dropped.
+func (t policyTarget) validationActions() []v1.ValidationAction {
+	if t.binding == nil || len(t.binding.Spec.ValidationActions) == 0 {
+		return []v1.ValidationAction{v1.Deny}
+	}
+	return t.binding.Spec.ValidationActions
+}
+
+// hasAction reports whether the action is one of the validation actions.
+func hasAction(actions []v1.ValidationAction, action v1.ValidationAction) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// countNotDenied counts a request failing the validations of a binding without the Deny action
+// in the counts of the actions it has.
+func countNotDenied(actions []v1.ValidationAction, warn, audit *int) {
+	if hasAction(actions, v1.Warn) {
+		*warn++
+	}
+	if hasAction(actions, v1.Audit) {
+		*audit++
+	}
+}
+
+// newPolicyTargets returns the policies in the loader with the ValidatingAdmissionPolicyBindings in the loaded resources,
+// in the order of the policy names and the binding names.
+func newPolicyTargets(loader *ResourceLoader) ([]policyTarget, error) {
+	bindings, err := loadedBindings(loader)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(loader.Vaps))
+	for name := range loader.Vaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var targets []policyTarget
+	for _, name := range names {
+		vap := loader.Vaps[name]
+		validator := kaptest.NewValidator(vap)
+		bs := bindings[name]
+		if len(bs) == 0 {
+			bs = []*v1.ValidatingAdmissionPolicyBinding{nil}
+		}
+		for _, b := range bs {
+			targets = append(targets, policyTarget{vap: vap, binding: b, validator: validator})
+		}
+	}
+	return targets, nil
+}
+
+// loadedBindings returns the ValidatingAdmissionPolicyBindings in the loaded resources keyed by the policy name,
+// in the order of the binding names.
+func loadedBindings(loader *ResourceLoader) (map[string][]*v1.ValidatingAdmissionPolicyBinding, error) {
+	bindings := map[string][]*v1.ValidatingAdmissionPolicyBinding{}
+	for ngvk, obj := range loader.Resources {
+		if !isBinding(obj.GroupVersionKind()) {
+			continue
+		}
+		// The warnings are reported when the binding is loaded.
+		b, _, err := toV1Binding(obj)
+		if err != nil {
+			return nil, fmt.Errorf("convert to ValidatingAdmissionPolicyBinding %q: %w", ngvk.Name, err)
+		}
+		bindings[b.Spec.PolicyName] = append(bindings[b.Spec.PolicyName], b)
+	}
+	for _, bs := range bindings {
+		sort.Slice(bs, func(i, j int) bool { return bs[i].Name < bs[j].Name })
+	}
+	return bindings, nil
+}
+
+// admissionRequest is a request evaluated against the bound policies.
+type admissionRequest struct {
+	attrs       *kaptest.RequestAttributes
+	obj, oldObj *unstructured.Unstructured
+	userInfo    *user.DefaultInfo
+	// tc is the test case to report the request in the same way as the test cases.
+	tc TestCase
+}
+
+// evalTarget evaluates the policy against the request if the request matches the policy and the binding.
+// It returns false if the request does not match.
+// A request failing the validations is reported as denied even if the binding only warns or audits it.
+func evalTarget(loader *ResourceLoader, t policyTarget, req *admissionRequest, namespaceObj *corev1.Namespace) (CaseReport, bool) {
+	matched, err := matchTarget(t, req, namespaceObj)
+	if err != nil {
+		return newSetupErrorResult(req.tc, []error{err}), true
+	}
+	if !matched {
+		return CaseReport{}, false
+	}
+
+	params, err := bindingParams(loader, t, req.attrs.Namespace)
+	if err != nil {
+		return newSetupErrorResult(req.tc, []error{err}), true
+	}
+	if len(params) == 0 {
+		// The binding does not apply without params unless parameterNotFoundAction is Deny.
+		if a := t.binding.Spec.ParamRef.ParameterNotFoundAction; a != nil && *a == v1.DenyAction {
+			return CaseReport{
+				Name:      caseName(req.tc),
+				Result:    ResultDeny,
+				Decisions: []DecisionReport{{Evaluation: ResultDeny, Message: "no params found for the binding"}},
+			}, true
+		}
+		return CaseReport{Name: caseName(req.tc), Result: ResultSkip}, true
+	}
+
+	// The request is denied if any of the params denies it in the same way as the API server.
+	var c CaseReport
+	for i, p := range params {
+		given := kaptest.ValidationParams{
+			NamespaceObj: namespaceObj,
+			UserInfo:     req.userInfo,
+			Request:      req.attrs,
+		}
+		if req.obj != nil {
+			given.Object = req.obj
+		}
+		if req.oldObj != nil {
+			given.OldObject = req.oldObj
+		}
+		if p != nil {
+			given.ParamObj = p
+		}
+		got := evalPolicy(t.vap, t.validator, req.tc, given)
+		if i == 0 || resultPrecedence[got.Result] > resultPrecedence[c.Result] {
+			c = got
+		}
+	}
+	return c, true
+}
+
+// resultPrecedence is the precedence of the results when a request is evaluated with multiple params.
+var resultPrecedence = map[Result]int{
+	ResultSkip:       0,
+	ResultAdmit:      1,
+	ResultError:      2,
+	ResultSetupError: 2,
+	ResultFatalError: 2,
+	ResultDeny:       3,
+}
+
+// matchTarget returns whether the request matches spec.matchConstraints of the policy and spec.matchResources of the binding.
+func matchTarget(t policyTarget, req *admissionRequest, namespaceObj *corev1.Namespace) (bool, error) {
+	constraints := []*v1.MatchResources{t.vap.Spec.MatchConstraints}
+	if t.binding != nil {
+		constraints = append(constraints, t.binding.Spec.MatchResources)
+	}
+	return matchRequest(req, namespaceObj, constraints...)
+}
+
+// matchRequest returns whether the request matches all the constraints.
+func matchRequest(req *admissionRequest, namespaceObj *corev1.Namespace, constraints ...*v1.MatchResources) (bool, error) {
+	attrs := admission.NewAttributesRecord(nil, nil, req.attrs.Kind, req.attrs.Namespace, req.attrs.Name,
+		req.attrs.Resource, req.attrs.SubResource, req.attrs.Operation, nil, req.attrs.DryRun, req.userInfo)
+	var objLabels []map[string]string
+	for _, o := range []*unstructured.Unstructured{req.obj, req.oldObj} {
+		if o != nil {
+			objLabels = append(objLabels, o.GetLabels())
+		}
+	}
+	var nsLabels map[string]string
+	if req.attrs.Resource.Group == "" && req.attrs.Resource.Resource == "namespaces" && len(objLabels) > 0 {
+		// The namespace selector is evaluated against the Namespace itself.
+		nsLabels = objLabels[0]
+	} else if namespaceObj != nil {
+		nsLabels = namespaceObj.Labels
+	}
+
+	for _, mr := range constraints {
+		ok, err := matchResources(mr, attrs, nsLabels, objLabels)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// givenRequest returns the request evaluated with the params of a test case.
+// The resource is guessed from the kind unless the attributes of the request are given.
+func givenRequest(given kaptest.ValidationParams) *admissionRequest {
+	req := &admissionRequest{}
+	req.obj, _ = given.Object.(*unstructured.Unstructured)
+	req.oldObj, _ = given.OldObject.(*unstructured.Unstructured)
+	req.userInfo, _ = given.UserInfo.(*user.DefaultInfo)
+	if given.Request != nil {
+		req.attrs = given.Request
+		return req
+	}
+	ref := req.obj
+	if ref == nil {
+		ref = req.oldObj
+	}
+	req.attrs = &kaptest.RequestAttributes{Operation: given.Operation()}
+	if ref != nil {
+		req.attrs.Kind = ref.GroupVersionKind()
+		req.attrs.Resource, _ = meta.UnsafeGuessKindToResource(req.attrs.Kind)
+		req.attrs.Namespace = ref.GetNamespace()
+		req.attrs.Name = ref.GetName()
+	}
+	return req
+}
+
+// bindingWarnings returns the warnings which the API server returns for the test case,
+// i.e. the messages of the failed validations for each binding with the Warn action matching the request.
+// The validations failed with errors are included unless the failurePolicy of the policy is Ignore.
+func bindingWarnings(vap *v1.ValidatingAdmissionPolicy, bindings []*v1.ValidatingAdmissionPolicyBinding, given kaptest.ValidationParams, c CaseReport) ([]string, error) {
+	var messages []string
+	ignoreErrors := vap.Spec.FailurePolicy != nil && *vap.Spec.FailurePolicy == v1.Ignore
+	for _, d := range c.Decisions {
+		if d.Evaluation == ResultDeny || (d.Evaluation == ResultError && !ignoreErrors) {
+			messages = append(messages, d.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return nil, nil
+	}
+
+	req := givenRequest(given)
+	var warnings []string
+	for _, b := range bindings {
+		if !hasAction(b.Spec.ValidationActions, v1.Warn) {
+			continue
+		}
+		matched, err := matchRequest(req, given.NamespaceObj, b.Spec.MatchResources)
+		if err != nil {
+			return nil, fmt.Errorf("match ValidatingAdmissionPolicyBinding %q: %w", b.Name, err)
+		}
+		if !matched {
+			continue
+		}
+		for _, m := range messages {
+			warnings = append(warnings, fmt.Sprintf("Validation failed for ValidatingAdmissionPolicy '%s' with binding '%s': %s", vap.Name, b.Name, m))
+		}
+	}
+	return warnings, nil
+}
+
+// matchResources returns whether the request matches the resource rules and the selectors.
+// A nil MatchResources matches all the requests.
+func matchResources(mr *v1.MatchResources, attrs admission.Attributes, nsLabels map[string]string, objLabels []map[string]string) (bool, error) {
+	if mr == nil {
+		return true, nil
+	}
+	if mr.NamespaceSelector != nil && (attrs.GetNamespace() != "" || nsLabels != nil) {
+		selector, err := metav1.LabelSelectorAsSelector(mr.NamespaceSelector)
+		if err != nil {
+			return false, fmt.Errorf("invalid namespaceSelector: %w", err)
+		}
+		if !selector.Matches(labels.Set(nsLabels)) {
+			return false, nil
+		}
+	}
+	if mr.ObjectSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(mr.ObjectSelector)
+		if err != nil {
+			return false, fmt.Errorf("invalid objectSelector: %w", err)
+		}
+		matched := false
+		for _, l := range objLabels {
+			if selector.Matches(labels.Set(l)) {
+				matched = true
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+	if len(mr.ResourceRules) > 0 && !matchRules(mr.ResourceRules, attrs) {
+		return false, nil
+	}
+	return !matchRules(mr.ExcludeResourceRules, attrs), nil
+}
+
+func matchRules(namedRules []v1.NamedRuleWithOperations, attrs admission.Attributes) bool {
+	for _, r := range namedRules {
+		if len(r.ResourceNames) > 0 && !contains(r.ResourceNames, attrs.GetName()) {
+			continue
+		}
+		m := rules.Matcher{Rule: r.RuleWithOperations, Attr: attrs}
+		if m.Matches() {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// bindingParams returns the params of the binding for a request in the namespace.
+// It returns a nil param if the policy has no paramKind.
+// The params of a namespaced paramKind are looked up in the namespace of the request
+// if paramRef.namespace is empty, in the same way as the API server.
+func bindingParams(loader *ResourceLoader, t policyTarget, namespace string) ([]*unstructured.Unstructured, error) {
+	paramKind := t.vap.Spec.ParamKind
+	if paramKind == nil {
+		return []*unstructured.Unstructured{nil}, nil
+	}
+	if t.binding == nil || t.binding.Spec.ParamRef == nil {
+		return nil, errors.New("params are required by spec.paramKind; load a ValidatingAdmissionPolicyBinding with paramRef")
+	}
+	ref := t.binding.Spec.ParamRef
+	gvk := schema.FromAPIVersionAndKind(paramKind.APIVersion, paramKind.Kind)
+	paramNamespace := ref.Namespace
+	if loader.isClusterScoped(gvk.GroupKind()) {
+		paramNamespace = ""
+	} else if paramNamespace == "" {
+		if namespace == "" {
+			return nil, errors.New("paramRef.namespace is required for a namespaced paramKind in a request on a cluster-scoped resource")
+		}
+		paramNamespace = namespace
+	}
+	if ref.Name != "" {
+		p, err := loader.GetResource(NewNameWithGVK(gvk, NamespacedName{Namespace: paramNamespace, Name: ref.Name}))
+		if err != nil {
+			return nil, fmt.Errorf("get param: %w", err)
+		}
+		if p == nil {
+			// A param not found is handled by parameterNotFoundAction.
+			return nil, nil
+		}
+		return []*unstructured.Unstructured{p}, nil
+	}
+
+	selector := labels.Everything()
+	if ref.Selector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(ref.Selector); err != nil {
+			return nil, fmt.Errorf("invalid paramRef.selector: %w", err)
+		}
+	}
+	var keys []NameWithGVK
+	for k, obj := range loader.Resources {
+		if k.Group != gvk.Group || k.Kind != gvk.Kind || k.Namespace != paramNamespace {
+			continue
+		}
+		if selector.Matches(labels.Set(obj.GetLabels())) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	params := make([]*unstructured.Unstructured, len(keys))
+	for i, k := range keys {
+		params[i] = loader.Resources[k]
+	}
+	return params, nil
+}
+
+// namespaceCache caches the namespaces looked up from the loader
+// so that the default namespace is logged only once for each name.
+type namespaceCache struct {
+	loader     *ResourceLoader
+	namespaces map[string]*corev1.Namespace
+}
+
+func newNamespaceCache(loader *ResourceLoader) *namespaceCache {
+	return &namespaceCache{loader: loader, namespaces: map[string]*corev1.Namespace{}}
+}
+
+// get returns the namespace from the loaded resources.
+// A Namespace without labels and annotations is used if it is not loaded.
+func (c *namespaceCache) get(name string) (*corev1.Namespace, error) {
+	if ns, ok := c.namespaces[name]; ok {
+		return ns, nil
+	}
+	ns, err := getNamespaceObjByName(c.loader, name)
+	if err != nil {
+		return nil, err
+	}
+	c.namespaces[name] = ns
+	return ns, nil
+}
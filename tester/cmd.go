@@ -0,0 +1,52 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import "time"
+
+type CmdConfig struct {
+	Debug   bool
+	Verbose bool
+
+	// ManifestPattern is the glob pattern of test manifests discovered in directories.
+	// It is matched against the path of each file relative to the searched directory.
+	ManifestPattern string
+	// Ignore is the list of glob patterns of files and directories skipped in the discovery.
+	Ignore []string
+	// Parallelism is the maximum number of manifests and test cases run concurrently.
+	Parallelism int
+	// ChangedSince is the git ref to run only the manifests affected by the files changed since it.
+	ChangedSince string
+	// Watch re-runs the manifests affected by file changes until interrupted.
+	Watch bool
+	// WatchInterval is the interval to check the changes of the files in the watch mode.
+	WatchInterval time.Duration
+	// Update rewrites the expectations of the failed test cases in the manifests to their results.
+	Update bool
+	// UpdateSnapshots rewrites the snapshot files with the results of the test cases.
+	UpdateSnapshots bool
+	// WarningsAsErrors makes the tests fail when loading the policies and resources has warnings.
+	WarningsAsErrors bool
+	// ApplyDefaults applies the defaults of the API server to the built-in objects in the resources.
+	ApplyDefaults bool
+	// ValidateFixtures validates the built-in objects in the resources against the Kubernetes API.
+	ValidateFixtures bool
+	// StrictNamespaces fails the test cases whose Namespaces are not in the resources.
+	StrictNamespaces bool
+	// Outputs is the list of destinations of the test results in the form of "format[=path]".
+	Outputs []string
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pfnet/kaptest"
+	v1 "k8s.io/api/admissionregistration/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	appsv1beta1 "k8s.io/api/apps/v1beta1"
+	appsv1beta2 "k8s.io/api/apps/v1beta2"
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	autoscalingv2 "k8s.io/api/autoscaling/v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apiserver/pkg/admission"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+)
+
+// applyRequestKind makes the params a request of tc.RequestKind, and converts the objects to the version
+// which the policy matches under spec.matchPolicy in the same way as the API server.
+// It returns false if the policy matches neither the request nor its equivalent versions.
+func applyRequestKind(vap *v1.ValidatingAdmissionPolicy, tc TestCase, loader *ResourceLoader, p *kaptest.ValidationParams) (bool, error) {
+	obj, _ := p.Object.(*unstructured.Unstructured)
+	oldObj, _ := p.OldObject.(*unstructured.Unstructured)
+	src := obj
+	if src == nil {
+		src = oldObj
+	}
+	reqKind := schema.GroupVersionKind{Group: tc.RequestKind.Group, Version: tc.RequestKind.Version, Kind: tc.RequestKind.Kind}
+	if reqKind.Group == "" {
+		reqKind.Group = src.GroupVersionKind().Group
+	}
+	if reqKind.Kind == "" {
+		reqKind.Kind = src.GetKind()
+	}
+	if reqKind.Version == "" {
+		return false, fmt.Errorf("requestKind.version is required")
+	}
+	equivalents := equivalentKinds(loader, reqKind)
+	if len(equivalents) > 0 && !isKnownKind(loader, reqKind) {
+		return false, fmt.Errorf("requestKind %s is not a known version of %s", reqKind.GroupVersion(), reqKind.GroupKind())
+	}
+	reqResource, _ := meta.UnsafeGuessKindToResource(reqKind)
+	req := &kaptest.RequestAttributes{
+		Operation: p.Operation(),
+		Kind:      reqKind,
+		Resource:  reqResource,
+		Namespace: src.GetNamespace(),
+		Name:      src.GetName(),
+		// The requests of the other test cases are dry-run as well.
+		DryRun: true,
+	}
+
+	// The policy sees the request as it is if it matches, or in the first equivalent version it matches.
+	// The request is not matched at all if the request or an equivalent version is excluded.
+	mc := vap.Spec.MatchConstraints
+	equivalent := mc == nil || mc.MatchPolicy == nil || *mc.MatchPolicy == v1.Equivalent
+	attrsFor := func(gvk schema.GroupVersionKind) admission.Attributes {
+		gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+		return admission.NewAttributesRecord(nil, nil, gvk, req.Namespace, req.Name, gvr, "", req.Operation, nil, true, nil)
+	}
+	if mc != nil {
+		if _, excluded := matchVersion(mc.ExcludeResourceRules, reqKind, equivalents, equivalent, attrsFor); excluded {
+			return false, nil
+		}
+	}
+	if mc == nil || len(mc.ResourceRules) == 0 {
+		req.VersionedKind = reqKind
+	} else if gvk, ok := matchVersion(mc.ResourceRules, reqKind, equivalents, equivalent, attrsFor); ok {
+		req.VersionedKind = gvk
+	} else {
+		return false, nil
+	}
+	req.VersionedResource, _ = meta.UnsafeGuessKindToResource(req.VersionedKind)
+
+	var err error
+	if obj != nil {
+		if p.Object, err = convertObject(loader, obj, req.VersionedKind.GroupVersion()); err != nil {
+			return false, fmt.Errorf("convert object: %w", err)
+		}
+	}
+	if oldObj != nil {
+		if p.OldObject, err = convertObject(loader, oldObj, req.VersionedKind.GroupVersion()); err != nil {
+			return false, fmt.Errorf("convert oldObject: %w", err)
+		}
+	}
+	p.Request = req
+	return true, nil
+}
+
+// matchVersion returns the version of the request matched by the rules in the same order as the API server:
+// the request itself is matched by any of the rules first, and then each rule is matched by the equivalent versions
+// if equivalent is true.
+func matchVersion(rules []v1.NamedRuleWithOperations, reqKind schema.GroupVersionKind, equivalents []schema.GroupVersionKind,
+	equivalent bool, attrsFor func(schema.GroupVersionKind) admission.Attributes) (schema.GroupVersionKind, bool) {
+	if matchRules(rules, attrsFor(reqKind)) {
+		return reqKind, true
+	}
+	if !equivalent {
+		return schema.GroupVersionKind{}, false
+	}
+	for _, r := range rules {
+		for _, gvk := range equivalents {
+			if matchRules([]v1.NamedRuleWithOperations{r}, attrsFor(gvk)) {
+				return gvk, true
+			}
+		}
+	}
+	return schema.GroupVersionKind{}, false
+}
+
+// equivalentKinds returns the other versions of the kind in the same group known to the built-in scheme
+// or the loaded CustomResourceDefinitions, in the order of their priority.
+func equivalentKinds(loader *ResourceLoader, gvk schema.GroupVersionKind) []schema.GroupVersionKind {
+	var kinds []schema.GroupVersionKind
+	for _, gv := range clientgoscheme.Scheme.PrioritizedVersionsForGroup(gvk.Group) {
+		if k := gv.WithKind(gvk.Kind); k != gvk && clientgoscheme.Scheme.Recognizes(k) {
+			kinds = append(kinds, k)
+		}
+	}
+	if crd, ok := loader.crds[gvk.GroupKind()]; ok {
+		for _, v := range crd.sortedVersions() {
+			if v != gvk.Version && crd.versions[v].served {
+				kinds = append(kinds, schema.GroupVersionKind{Group: gvk.Group, Version: v, Kind: gvk.Kind})
+			}
+		}
+	}
+	return kinds
+}
+
+// isKnownKind returns whether the kind is a built-in kind or a served version of a loaded CustomResourceDefinition.
+func isKnownKind(loader *ResourceLoader, gvk schema.GroupVersionKind) bool {
+	if crd, ok := loader.crds[gvk.GroupKind()]; ok {
+		return crd.versions[gvk.Version].served
+	}
+	return clientgoscheme.Scheme.Recognizes(gvk)
+}
+
+// convertObject converts the object to the version.
+// The built-in objects are converted by the conversions registered in conversionScheme, and it is an error
+// if no conversion is registered between the versions or the object has fields unknown to its version.
+// The custom resources are converted by replacing apiVersion as the None conversion strategy of CustomResourceDefinitions.
+func convertObject(loader *ResourceLoader, obj *unstructured.Unstructured, gv schema.GroupVersion) (*unstructured.Unstructured, error) {
+	if obj.GroupVersionKind().GroupVersion() == gv {
+		return obj, nil
+	}
+	gvk := gv.WithKind(obj.GetKind())
+	if _, ok := loader.crds[gvk.GroupKind()]; ok {
+		out := obj.DeepCopy()
+		out.SetAPIVersion(gv.String())
+		return out, nil
+	}
+	in, err := conversionScheme.New(obj.GroupVersionKind())
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(obj.Object, in, true); err != nil {
+		return nil, err
+	}
+	out, err := conversionScheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if err := conversionScheme.Convert(in, out, nil); err != nil {
+		return nil, fmt.Errorf("%s to %s: %w", obj.GroupVersionKind().GroupVersion(), gv, err)
+	}
+	out.GetObjectKind().SetGroupVersionKind(gvk)
+	return typedToUnstructured(out)
+}
+
+// conversionScheme is the scheme of the built-in types with the conversions between their versions supported by kaptest.
+// The API server converts the objects through the internal types, which are not available outside of Kubernetes,
+// so the conversions are registered for each pair of versions, and the other pairs are not supported.
+var conversionScheme = newConversionScheme()
+
+// sameSchemaKinds is the pairs of the built-in kinds whose versions have the same fields.
+var sameSchemaKinds = [][2]runtime.Object{
+	{&appsv1beta1.Deployment{}, &appsv1.Deployment{}},
+	{&appsv1beta1.StatefulSet{}, &appsv1.StatefulSet{}},
+	{&appsv1beta1.ControllerRevision{}, &appsv1.ControllerRevision{}},
+	{&appsv1beta2.Deployment{}, &appsv1.Deployment{}},
+	{&appsv1beta2.StatefulSet{}, &appsv1.StatefulSet{}},
+	{&appsv1beta2.DaemonSet{}, &appsv1.DaemonSet{}},
+	{&appsv1beta2.ReplicaSet{}, &appsv1.ReplicaSet{}},
+	{&appsv1beta2.ControllerRevision{}, &appsv1.ControllerRevision{}},
+}
+
+func newConversionScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(s))
+	for _, pair := range sameSchemaKinds {
+		utilruntime.Must(s.AddConversionFunc(pair[0], pair[1], convertSameSchema))
+		utilruntime.Must(s.AddConversionFunc(pair[1], pair[0], convertSameSchema))
+	}
+	utilruntime.Must(s.AddConversionFunc(&autoscalingv1.HorizontalPodAutoscaler{}, &autoscalingv2.HorizontalPodAutoscaler{}, func(a, b any, _ conversion.Scope) error {
+		return convertHPAV1ToV2(a.(*autoscalingv1.HorizontalPodAutoscaler), b.(*autoscalingv2.HorizontalPodAutoscaler))
+	}))
+	utilruntime.Must(s.AddConversionFunc(&autoscalingv2.HorizontalPodAutoscaler{}, &autoscalingv1.HorizontalPodAutoscaler{}, func(a, b any, _ conversion.Scope) error {
+		return convertHPAV2ToV1(a.(*autoscalingv2.HorizontalPodAutoscaler), b.(*autoscalingv1.HorizontalPodAutoscaler))
+	}))
+	return s
+}
+
+// convertSameSchema converts the object to the other version with the same fields through JSON.
+// A field unknown to the other version is an error instead of being dropped.
+func convertSameSchema(a, b any, _ conversion.Scope) error {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(b)
+}
+
+// hpaAnnotationPrefix is the prefix of the annotations where autoscaling/v1 keeps the fields of autoscaling/v2.
+const hpaAnnotationPrefix = "autoscaling.alpha.kubernetes.io/"
+
+func convertHPAV1ToV2(in *autoscalingv1.HorizontalPodAutoscaler, out *autoscalingv2.HorizontalPodAutoscaler) error {
+	for k := range in.Annotations {
+		if strings.HasPrefix(k, hpaAnnotationPrefix) {
+			return fmt.Errorf("annotation %s of autoscaling/v1 HorizontalPodAutoscaler is not supported in the conversion", k)
+		}
+	}
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = autoscalingv2.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingv2.CrossVersionObjectReference(in.Spec.ScaleTargetRef),
+		MinReplicas:    in.Spec.MinReplicas,
+		MaxReplicas:    in.Spec.MaxReplicas,
+	}
+	if t := in.Spec.TargetCPUUtilizationPercentage; t != nil {
+		out.Spec.Metrics = []autoscalingv2.MetricSpec{{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricSource{
+				Name:   corev1.ResourceCPU,
+				Target: autoscalingv2.MetricTarget{Type: autoscalingv2.UtilizationMetricType, AverageUtilization: ptr.To(*t)},
+			},
+		}}
+	}
+	out.Status = autoscalingv2.HorizontalPodAutoscalerStatus{
+		ObservedGeneration: in.Status.ObservedGeneration,
+		LastScaleTime:      in.Status.LastScaleTime,
+		CurrentReplicas:    in.Status.CurrentReplicas,
+		DesiredReplicas:    in.Status.DesiredReplicas,
+	}
+	if c := in.Status.CurrentCPUUtilizationPercentage; c != nil {
+		out.Status.CurrentMetrics = []autoscalingv2.MetricStatus{{
+			Type: autoscalingv2.ResourceMetricSourceType,
+			Resource: &autoscalingv2.ResourceMetricStatus{
+				Name:    corev1.ResourceCPU,
+				Current: autoscalingv2.MetricValueStatus{AverageUtilization: ptr.To(*c)},
+			},
+		}}
+	}
+	return nil
+}
+
+// convertHPAV2ToV1 converts the HorizontalPodAutoscaler to autoscaling/v1.
+// The fields which autoscaling/v1 can only keep in the annotations, e.g. the metrics other than the CPU utilization,
+// are not supported.
+func convertHPAV2ToV1(in *autoscalingv2.HorizontalPodAutoscaler, out *autoscalingv1.HorizontalPodAutoscaler) error {
+	if in.Spec.Behavior != nil || len(in.Status.Conditions) > 0 {
+		return errors.New("spec.behavior and status.conditions of HorizontalPodAutoscaler cannot be converted to autoscaling/v1")
+	}
+	out.ObjectMeta = *in.ObjectMeta.DeepCopy()
+	out.Spec = autoscalingv1.HorizontalPodAutoscalerSpec{
+		ScaleTargetRef: autoscalingv1.CrossVersionObjectReference(in.Spec.ScaleTargetRef),
+		MinReplicas:    in.Spec.MinReplicas,
+		MaxReplicas:    in.Spec.MaxReplicas,
+	}
+	for _, m := range in.Spec.Metrics {
+		if m.Type != autoscalingv2.ResourceMetricSourceType || m.Resource == nil || m.Resource.Name != corev1.ResourceCPU ||
+			m.Resource.Target.Type != autoscalingv2.UtilizationMetricType || out.Spec.TargetCPUUtilizationPercentage != nil {
+			return errors.New("metrics of HorizontalPodAutoscaler other than a CPU utilization cannot be converted to autoscaling/v1")
+		}
+		out.Spec.TargetCPUUtilizationPercentage = m.Resource.Target.AverageUtilization
+	}
+	out.Status = autoscalingv1.HorizontalPodAutoscalerStatus{
+		ObservedGeneration: in.Status.ObservedGeneration,
+		LastScaleTime:      in.Status.LastScaleTime,
+		CurrentReplicas:    in.Status.CurrentReplicas,
+		DesiredReplicas:    in.Status.DesiredReplicas,
+	}
+	for _, m := range in.Status.CurrentMetrics {
+		if m.Type != autoscalingv2.ResourceMetricSourceType || m.Resource == nil || m.Resource.Name != corev1.ResourceCPU ||
+			out.Status.CurrentCPUUtilizationPercentage != nil {
+			return errors.New("current metrics of HorizontalPodAutoscaler other than a CPU utilization cannot be converted to autoscaling/v1")
+		}
+		out.Status.CurrentCPUUtilizationPercentage = m.Resource.Current.AverageUtilization
+	}
+	return nil
+}
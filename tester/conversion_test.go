@@ -0,0 +1,124 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRunner_RequestKind(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		manifest string
+		want     map[string][]Result
+		// wantErrs is the part of the error of each case.
+		wantErrs map[string][]string
+	}{
+		{
+			name:     "ok: equivalent and exact match policies",
+			manifest: "kaptest.yaml",
+			want: map[string][]Result{
+				"equivalent": {ResultAdmit},
+				"exact":      {ResultSkip, ResultDeny},
+				"excluded":   {ResultSkip, ResultSkip},
+				"hpa-cpu":    {ResultAdmit},
+			},
+		},
+		{
+			name:     "err: unknown version",
+			manifest: "invalid-unknown-version.yaml",
+			want:     map[string][]Result{"equivalent": {ResultSetupError}},
+			wantErrs: map[string][]string{"equivalent": {"requestKind apps/v2 is not a known version of Deployment.apps"}},
+		},
+		{
+			name:     "err: unsupported conversions",
+			manifest: "invalid-conversion.yaml",
+			want: map[string][]Result{
+				"equivalent": {ResultSetupError},
+				"hpa-cpu":    {ResultSetupError},
+			},
+			wantErrs: map[string][]string{
+				"equivalent": {`unknown field "rollbackTo"`},
+				"hpa-cpu":    {"autoscaling/v2beta2 to autoscaling/v2: converting (v2beta2.HorizontalPodAutoscaler) to (v2.HorizontalPodAutoscaler): unknown conversion"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			report, err := NewRunner(Options{}).Run([]string{filepath.Join("testdata/vap-with-request-kind.test", tt.manifest)})
+			mustNil(t, err)
+			m := report.Manifests[0]
+			if m.Error != "" {
+				t.Fatalf("manifest error: %s", m.Error)
+			}
+			for _, s := range m.Suites {
+				if len(s.Cases) != len(tt.want[s.Policy]) {
+					t.Fatalf("%s: got %d cases, want %d", s.Policy, len(s.Cases), len(tt.want[s.Policy]))
+				}
+				for i, c := range s.Cases {
+					if c.Result != tt.want[s.Policy][i] {
+						t.Errorf("%s %s: got %s, want %s; errors %s", s.Policy, c.Name, c.Result, tt.want[s.Policy][i], strings.Join(c.Errors, ", "))
+					}
+					if want := tt.wantErrs[s.Policy]; want != nil && (len(c.Errors) != 1 || !strings.Contains(c.Errors[0], want[i])) {
+						t.Errorf("%s %s: errors = %q, want %q", s.Policy, c.Name, c.Errors, want[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestConvertObject_HorizontalPodAutoscaler(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	mustNil(t, loader.LoadResources([]string{"testdata/vap-with-request-kind.test/resources.yaml"}))
+	v1, err := loader.GetResource(NewNameWithGVK(schema.GroupVersionKind{Group: "autoscaling", Version: "v1", Kind: "HorizontalPodAutoscaler"}, NamespacedName{Namespace: "default", Name: "hpa"}))
+	mustNil(t, err)
+
+	v2, err := convertObject(loader, v1, schema.GroupVersion{Group: "autoscaling", Version: "v2"})
+	mustNil(t, err)
+	metrics, _, _ := unstructured.NestedSlice(v2.Object, "spec", "metrics")
+	want := []any{map[string]any{
+		"type":     "Resource",
+		"resource": map[string]any{"name": "cpu", "target": map[string]any{"type": "Utilization", "averageUtilization": int64(50)}},
+	}}
+	if !reflect.DeepEqual(metrics, want) {
+		t.Errorf("spec.metrics = %#v, want %#v", metrics, want)
+	}
+
+	back, err := convertObject(loader, v2, schema.GroupVersion{Group: "autoscaling", Version: "v1"})
+	mustNil(t, err)
+	if got, _, _ := unstructured.NestedInt64(back.Object, "spec", "targetCPUUtilizationPercentage"); got != 50 {
+		t.Errorf("spec.targetCPUUtilizationPercentage = %d, want 50", got)
+	}
+
+	mustNil(t, unstructured.SetNestedField(v2.Object, []any{map[string]any{
+		"type":     "Resource",
+		"resource": map[string]any{"name": "memory", "target": map[string]any{"type": "Utilization", "averageUtilization": int64(50)}},
+	}}, "spec", "metrics"))
+	if _, err := convertObject(loader, v2, schema.GroupVersion{Group: "autoscaling", Version: "v1"}); err == nil {
+		t.Errorf("convertObject() error = nil, want error for the metrics which autoscaling/v1 cannot represent")
+	}
+}
@@ -0,0 +1,214 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utiljson "k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+)
+
+const crdGroup = "apiextensions.k8s.io"
+
+// customResourceDefinition is the part of a CustomResourceDefinition used to process the custom resources.
+type customResourceDefinition struct {
+	name       string
+	namespaced bool
+	versions   map[string]crdVersion
+}
+
+type crdVersion struct {
+	served bool
+	// schema is nil if the version has no schema.
+	schema *spec.Schema
+}
+
+var crdGVK = schema.GroupVersionKind{Group: crdGroup, Version: "v1", Kind: "CustomResourceDefinition"}
+
+// applyCustomResourceDefinitions processes the loaded custom resources with the schemas of the loaded
+// CustomResourceDefinitions in the same way as the API server before admission:
+// the unknown fields are pruned, the defaults are applied, the values are typed by the schema and the objects are validated.
+// An invalid custom resource is kept, and GetResource returns an error for it so that the test cases using it fail.
+// It is run whenever resources are loaded, and skips the CustomResourceDefinitions and the custom resources already processed.
+func (r *ResourceLoader) applyCustomResourceDefinitions() {
+	for _, k := range r.sortedResourceKeys() {
+		obj := r.Resources[k]
+		if obj.GroupVersionKind() != crdGVK || r.crdProcessed[k] {
+			continue
+		}
+		r.crdProcessed[k] = true
+		crd, gk, err := parseCustomResourceDefinition(obj)
+		if err != nil {
+			r.addIssue(LoadIssueError, r.resourceSources[k], "CustomResourceDefinition %q: %v", obj.GetName(), err)
+			continue
+		}
+		r.crds[gk] = crd
+	}
+	if len(r.crds) == 0 {
+		return
+	}
+	for _, k := range r.sortedResourceKeys() {
+		crd, ok := r.crds[schema.GroupKind{Group: k.Group, Kind: k.Kind}]
+		if !ok || r.crdProcessed[k] {
+			continue
+		}
+		r.crdProcessed[k] = true
+		if err := crd.apply(r.Resources[k], k.Version); err != nil {
+			r.invalid[k] = err
+		}
+	}
+}
+
+func parseCustomResourceDefinition(obj *unstructured.Unstructured) (*customResourceDefinition, schema.GroupKind, error) {
+	group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+	scope, _, _ := unstructured.NestedString(obj.Object, "spec", "scope")
+	if group == "" || kind == "" {
+		return nil, schema.GroupKind{}, errors.New("spec.group and spec.names.kind are required")
+	}
+	crd := &customResourceDefinition{name: obj.GetName(), namespaced: scope != "Cluster", versions: map[string]crdVersion{}}
+	versions, _, err := unstructured.NestedSlice(obj.Object, "spec", "versions")
+	if err != nil {
+		return nil, schema.GroupKind{}, fmt.Errorf("spec.versions: %w", err)
+	}
+	for i, item := range versions {
+		v, ok := item.(map[string]any)
+		if !ok {
+			return nil, schema.GroupKind{}, fmt.Errorf("spec.versions[%d] is not an object", i)
+		}
+		name, _, _ := unstructured.NestedString(v, "name")
+		served, _, _ := unstructured.NestedBool(v, "served")
+		cv := crdVersion{served: served}
+		if raw, found, _ := unstructured.NestedFieldNoCopy(v, "schema", "openAPIV3Schema"); found {
+			b, err := json.Marshal(raw)
+			if err != nil {
+				return nil, schema.GroupKind{}, err
+			}
+			cv.schema = &spec.Schema{}
+			if err := json.Unmarshal(b, cv.schema); err != nil {
+				return nil, schema.GroupKind{}, fmt.Errorf("spec.versions[%d].schema.openAPIV3Schema: %w", i, err)
+			}
+		}
+		crd.versions[name] = cv
+	}
+	return crd, schema.GroupKind{Group: group, Kind: kind}, nil
+}
+
+// sortedVersions returns the names of the versions in lexical order.
+func (c *customResourceDefinition) sortedVersions() []string {
+	names := make([]string, 0, len(c.versions))
+	for name := range c.versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apply prunes, defaults and validates the custom resource in place.
+func (c *customResourceDefinition) apply(obj *unstructured.Unstructured, version string) error {
+	v, ok := c.versions[version]
+	if !ok {
+		return fmt.Errorf("version %q is not defined in CustomResourceDefinition %q", version, c.name)
+	}
+	if !v.served {
+		return fmt.Errorf("version %q is not served by CustomResourceDefinition %q", version, c.name)
+	}
+	if v.schema == nil {
+		return nil
+	}
+	pruneAndDefault(obj.Object, v.schema, true)
+	res := validate.NewSchemaValidator(v.schema, nil, "", strfmt.Default).Validate(obj.Object)
+	if res.IsValid() {
+		return nil
+	}
+	msgs := make([]string, len(res.Errors))
+	for i, err := range res.Errors {
+		msgs[i] = err.Error()
+	}
+	sort.Strings(msgs)
+	return fmt.Errorf("invalid %s: %s", obj.GetKind(), strings.Join(msgs, "; "))
+}
+
+// pruneAndDefault drops the fields not specified by the structural schema and sets the default values of the missing fields.
+// The integers are converted to int64 since the fixtures are decoded with float64 numbers.
+// apiVersion, kind and metadata of the root and the embedded resources are kept as they are.
+func pruneAndDefault(v any, s *spec.Schema, resource bool) any {
+	switch val := v.(type) {
+	case map[string]any:
+		preserve, _ := s.Extensions.GetBool("x-kubernetes-preserve-unknown-fields")
+		embedded, _ := s.Extensions.GetBool("x-kubernetes-embedded-resource")
+		resource = resource || embedded
+		for k, child := range val {
+			if resource && (k == "apiVersion" || k == "kind" || k == "metadata") {
+				continue
+			}
+			if ps, ok := s.Properties[k]; ok {
+				val[k] = pruneAndDefault(child, &ps, false)
+				continue
+			}
+			if ap := s.AdditionalProperties; ap != nil && ap.Schema != nil {
+				val[k] = pruneAndDefault(child, ap.Schema, false)
+				continue
+			}
+			if !preserve && (s.AdditionalProperties == nil || !s.AdditionalProperties.Allows) && s.Type.Contains("object") {
+				delete(val, k)
+			}
+		}
+		for k, ps := range s.Properties {
+			if cur, ok := val[k]; (ok && cur != nil) || ps.Default == nil || (ok && ps.Nullable) {
+				continue
+			}
+			if d, err := copyJSONValue(ps.Default); err == nil {
+				val[k] = pruneAndDefault(d, &ps, false)
+			}
+		}
+	case []any:
+		if s.Items != nil && s.Items.Schema != nil {
+			for i, item := range val {
+				val[i] = pruneAndDefault(item, s.Items.Schema, false)
+			}
+		}
+	case float64:
+		intOrString, _ := s.Extensions.GetBool("x-kubernetes-int-or-string")
+		if (s.Type.Contains("integer") || intOrString) && val == float64(int64(val)) {
+			return int64(val)
+		}
+	}
+	return v
+}
+
+// copyJSONValue returns a deep copy of the value with the integers as int64 like the decoded objects.
+func copyJSONValue(v any) (any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := utiljson.Unmarshal(b, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResourceLoader_CustomResourceDefinitions(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		widget  string
+		want    map[string]any
+		wantErr string
+	}{
+		{
+			name:   "ok: defaults are applied",
+			widget: "defaulted.yaml",
+			want:   map[string]any{"size": int64(2), "color": "blue", "parts": []any{map[string]any{"name": "a", "count": int64(1)}}},
+		},
+		{
+			name:   "ok: unknown fields are pruned",
+			widget: "pruned.yaml",
+			want: map[string]any{
+				"size":     int64(2),
+				"color":    "blue",
+				"labels":   map[string]any{"app": "a"},
+				"template": map[string]any{"kind": "Pod", "anything": "kept"},
+			},
+		},
+		{
+			name:    "err: invalid fields",
+			widget:  "invalid-fields.yaml",
+			wantErr: `Widget:default/w: invalid Widget: spec.color in body should be one of [blue red]; spec.size in body must be of type integer: "string"`,
+		},
+		{
+			name:    "err: required field",
+			widget:  "invalid-required.yaml",
+			wantErr: "Widget:default/w: invalid Widget: spec.size in body is required",
+		},
+		{
+			name:    "err: version not served",
+			widget:  "invalid-version.yaml",
+			wantErr: `Widget:default/w: version "v1beta1" is not served by CustomResourceDefinition "widgets.example.com"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			loader := NewResourceLoader()
+			mustNil(t, loader.LoadResources([]string{
+				"testdata/vap-with-crds.test/crd.yaml",
+				filepath.Join("testdata/vap-with-crds.test/widgets", tt.widget),
+			}))
+			if len(loader.Issues) > 0 {
+				t.Fatalf("Issues = %v, want none", loader.Issues)
+			}
+
+			got, err := loader.GetResource(NewNameWithGVK(schema.GroupVersionKind{Kind: "Widget"}, NamespacedName{Namespace: "default", Name: "w"}))
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Errorf("GetResource() error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			mustNil(t, err)
+			if !reflect.DeepEqual(got.Object["spec"], tt.want) {
+				t.Errorf("spec = %#v, want %#v", got.Object["spec"], tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceLoader_CustomResourceDefinitions_Invalid(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	mustNil(t, loader.LoadResources([]string{"testdata/vap-with-crds.test/invalid-crd.yaml"}))
+	if len(loader.Issues) != 1 || !strings.Contains(loader.Issues[0].Message, "spec.group and spec.names.kind are required") {
+		t.Errorf("Issues = %v, want the error of the CustomResourceDefinition", loader.Issues)
+	}
+}
+
+func TestResourceLoader_CustomResourceDefinitions_LoadedLater(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	mustNil(t, loader.LoadResources([]string{"testdata/vap-with-crds.test/widgets/defaulted.yaml"}))
+	mustNil(t, loader.LoadResources([]string{"testdata/vap-with-crds.test/crd.yaml"}))
+	got, err := loader.GetResource(NewNameWithGVK(schema.GroupVersionKind{Kind: "Widget"}, NamespacedName{Namespace: "default", Name: "w"}))
+	mustNil(t, err)
+	if color, _, _ := unstructured.NestedString(got.Object, "spec", "color"); color != "blue" {
+		t.Errorf("spec.color = %q, want the default", color)
+	}
+}
+
+func TestRunner_CustomResourceDefinitions(t *testing.T) {
+	t.Parallel()
+	report, err := NewRunner(Options{}).Run([]string{
+		"testdata/vap-with-crds.test/kaptest.yaml",
+		"testdata/vap-with-crds.test/invalid-widget.yaml",
+	})
+	mustNil(t, err)
+	if len(report.Manifests) != 2 {
+		t.Fatalf("got %d manifests, want 2", len(report.Manifests))
+	}
+	if c := report.Manifests[0].Suites[0].Cases[0]; c.Result != ResultAdmit || !c.Pass {
+		t.Errorf("defaulted widget: got %+v, want admit", c)
+	}
+	if c := report.Manifests[1].Suites[0].Cases[0]; c.Result != ResultSetupError || len(c.Errors) == 0 ||
+		!strings.Contains(c.Errors[0], "spec.size in body should be greater than or equal to 1") {
+		t.Errorf("invalid widget: got %+v, want setup error", c)
+	}
+}
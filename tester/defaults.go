@@ -0,0 +1,476 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/ptr"
+)
+
+// defaulters is the defaulting functions of the API server for the commonly used built-in kinds.
+// client-go has no defaulting functions since they are a part of the API server, so they are written here.
+// The objects of the other kinds are not defaulted.
+var defaulters = map[schema.GroupVersionKind]func(runtime.Object){
+	corev1.SchemeGroupVersion.WithKind("Pod"):                   func(obj runtime.Object) { setPodDefaults(obj.(*corev1.Pod)) },
+	corev1.SchemeGroupVersion.WithKind("PodTemplate"):           func(obj runtime.Object) { setPodSpecDefaults(&obj.(*corev1.PodTemplate).Template.Spec) },
+	corev1.SchemeGroupVersion.WithKind("ReplicationController"): func(obj runtime.Object) { setReplicationControllerDefaults(obj.(*corev1.ReplicationController)) },
+	corev1.SchemeGroupVersion.WithKind("Service"):               func(obj runtime.Object) { setServiceDefaults(obj.(*corev1.Service)) },
+	corev1.SchemeGroupVersion.WithKind("Namespace"):             func(obj runtime.Object) { setNamespaceDefaults(obj.(*corev1.Namespace)) },
+	appsv1.SchemeGroupVersion.WithKind("Deployment"):            func(obj runtime.Object) { setDeploymentDefaults(obj.(*appsv1.Deployment)) },
+	appsv1.SchemeGroupVersion.WithKind("ReplicaSet"):            func(obj runtime.Object) { setReplicaSetDefaults(obj.(*appsv1.ReplicaSet)) },
+	appsv1.SchemeGroupVersion.WithKind("StatefulSet"):           func(obj runtime.Object) { setStatefulSetDefaults(obj.(*appsv1.StatefulSet)) },
+	appsv1.SchemeGroupVersion.WithKind("DaemonSet"):             func(obj runtime.Object) { setDaemonSetDefaults(obj.(*appsv1.DaemonSet)) },
+	batchv1.SchemeGroupVersion.WithKind("Job"):                  func(obj runtime.Object) { setJobDefaults(obj.(*batchv1.Job)) },
+	batchv1.SchemeGroupVersion.WithKind("CronJob"):              func(obj runtime.Object) { setCronJobDefaults(obj.(*batchv1.CronJob)) },
+}
+
+// ApplyDefaults replaces the loaded objects of the kinds in defaulters with the ones defaulted in the same way as the API server
+// before admission, e.g. spec.replicas of Deployments and imagePullPolicy of containers.
+// The fields unknown to these kinds are dropped. The objects of the other kinds are left as they are.
+// An object which cannot be defaulted, e.g. with a string in an integer field, is kept,
+// and GetResource returns an error for it so that the test cases using it fail.
+func (r *ResourceLoader) ApplyDefaults() {
+	for _, k := range r.sortedResourceKeys() {
+		if r.invalid[k] != nil {
+			continue
+		}
+		defaulted, err := applyDefaults(r.Resources[k])
+		if err != nil {
+			r.invalid[k] = fmt.Errorf("apply defaults: %w", err)
+			continue
+		}
+		r.Resources[k] = defaulted
+	}
+}
+
+// applyDefaults returns the defaulted object if its kind has a defaulter, or the object itself.
+func applyDefaults(obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	gvk := obj.GroupVersionKind()
+	setDefaults, ok := defaulters[gvk]
+	if !ok {
+		return obj, nil
+	}
+	typed, err := clientgoscheme.Scheme.New(gvk)
+	if err != nil {
+		return nil, err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, typed); err != nil {
+		return nil, err
+	}
+	setDefaults(typed)
+	return typedToUnstructured(typed)
+}
+
+// typedToUnstructured converts the built-in object to unstructured in the same form as the fixtures.
+func typedToUnstructured(typed runtime.Object) (*unstructured.Unstructured, error) {
+	m, err := runtime.DefaultUnstructuredConverter.ToUnstructured(typed)
+	if err != nil {
+		return nil, err
+	}
+	// The zero creationTimestamp is converted to null, which the fixture does not have.
+	if ts, found, _ := unstructured.NestedFieldNoCopy(m, "metadata", "creationTimestamp"); found && ts == nil {
+		unstructured.RemoveNestedField(m, "metadata", "creationTimestamp")
+	}
+	return &unstructured.Unstructured{Object: m}, nil
+}
+
+func setPodDefaults(pod *corev1.Pod) {
+	setPodSpecDefaults(&pod.Spec)
+	// The requests of the containers in Pods, not in the pod templates, are defaulted to the limits.
+	for _, cs := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range cs {
+			setResourceRequestDefaults(&cs[i].Resources)
+		}
+	}
+}
+
+func setResourceRequestDefaults(r *corev1.ResourceRequirements) {
+	for name, limit := range r.Limits {
+		if _, ok := r.Requests[name]; ok {
+			continue
+		}
+		if r.Requests == nil {
+			r.Requests = corev1.ResourceList{}
+		}
+		r.Requests[name] = limit.DeepCopy()
+	}
+}
+
+func setPodSpecDefaults(spec *corev1.PodSpec) {
+	if spec.DNSPolicy == "" {
+		spec.DNSPolicy = corev1.DNSClusterFirst
+	}
+	if spec.RestartPolicy == "" {
+		spec.RestartPolicy = corev1.RestartPolicyAlways
+	}
+	if spec.SecurityContext == nil {
+		spec.SecurityContext = &corev1.PodSecurityContext{}
+	}
+	if spec.TerminationGracePeriodSeconds == nil {
+		spec.TerminationGracePeriodSeconds = ptr.To(int64(corev1.DefaultTerminationGracePeriodSeconds))
+	}
+	if spec.SchedulerName == "" {
+		spec.SchedulerName = corev1.DefaultSchedulerName
+	}
+	if spec.EnableServiceLinks == nil {
+		spec.EnableServiceLinks = ptr.To(corev1.DefaultEnableServiceLinks)
+	}
+	for i := range spec.InitContainers {
+		setContainerDefaults(&spec.InitContainers[i], spec.HostNetwork)
+	}
+	for i := range spec.Containers {
+		setContainerDefaults(&spec.Containers[i], spec.HostNetwork)
+	}
+	for i := range spec.Volumes {
+		setVolumeDefaults(&spec.Volumes[i])
+	}
+}
+
+func setVolumeDefaults(v *corev1.Volume) {
+	if ptr.AllPtrFieldsNil(&v.VolumeSource) {
+		v.EmptyDir = &corev1.EmptyDirVolumeSource{}
+	}
+	if s := v.Secret; s != nil && s.DefaultMode == nil {
+		s.DefaultMode = ptr.To(corev1.SecretVolumeSourceDefaultMode)
+	}
+	if c := v.ConfigMap; c != nil && c.DefaultMode == nil {
+		c.DefaultMode = ptr.To(corev1.ConfigMapVolumeSourceDefaultMode)
+	}
+	if d := v.DownwardAPI; d != nil {
+		if d.DefaultMode == nil {
+			d.DefaultMode = ptr.To(corev1.DownwardAPIVolumeSourceDefaultMode)
+		}
+		setDownwardAPIItemDefaults(d.Items)
+	}
+	if p := v.Projected; p != nil {
+		if p.DefaultMode == nil {
+			p.DefaultMode = ptr.To(corev1.ProjectedVolumeSourceDefaultMode)
+		}
+		for _, src := range p.Sources {
+			if src.DownwardAPI != nil {
+				setDownwardAPIItemDefaults(src.DownwardAPI.Items)
+			}
+		}
+	}
+	if h := v.HostPath; h != nil && h.Type == nil {
+		h.Type = ptr.To(corev1.HostPathUnset)
+	}
+}
+
+func setDownwardAPIItemDefaults(items []corev1.DownwardAPIVolumeFile) {
+	for _, item := range items {
+		setObjectFieldSelectorDefaults(item.FieldRef)
+	}
+}
+
+func setObjectFieldSelectorDefaults(s *corev1.ObjectFieldSelector) {
+	if s != nil && s.APIVersion == "" {
+		s.APIVersion = "v1"
+	}
+}
+
+func setContainerDefaults(c *corev1.Container, hostNetwork bool) {
+	if c.ImagePullPolicy == "" {
+		c.ImagePullPolicy = defaultImagePullPolicy(c.Image)
+	}
+	if c.TerminationMessagePath == "" {
+		c.TerminationMessagePath = corev1.TerminationMessagePathDefault
+	}
+	if c.TerminationMessagePolicy == "" {
+		c.TerminationMessagePolicy = corev1.TerminationMessageReadFile
+	}
+	for i := range c.Ports {
+		p := &c.Ports[i]
+		if p.Protocol == "" {
+			p.Protocol = corev1.ProtocolTCP
+		}
+		// The host ports are the container ports on the host network.
+		if hostNetwork && p.HostPort == 0 {
+			p.HostPort = p.ContainerPort
+		}
+	}
+	for _, e := range c.Env {
+		if e.ValueFrom != nil {
+			setObjectFieldSelectorDefaults(e.ValueFrom.FieldRef)
+		}
+	}
+	for _, p := range []*corev1.Probe{c.LivenessProbe, c.ReadinessProbe, c.StartupProbe} {
+		if p != nil {
+			setProbeDefaults(p)
+			setHTTPGetActionDefaults(p.HTTPGet)
+		}
+	}
+	if c.Lifecycle != nil {
+		for _, h := range []*corev1.LifecycleHandler{c.Lifecycle.PostStart, c.Lifecycle.PreStop} {
+			if h != nil {
+				setHTTPGetActionDefaults(h.HTTPGet)
+			}
+		}
+	}
+}
+
+func setHTTPGetActionDefaults(a *corev1.HTTPGetAction) {
+	if a == nil {
+		return
+	}
+	if a.Path == "" {
+		a.Path = "/"
+	}
+	if a.Scheme == "" {
+		a.Scheme = corev1.URISchemeHTTP
+	}
+}
+
+// defaultImagePullPolicy returns Always for the latest or untagged image, and IfNotPresent for the others.
+func defaultImagePullPolicy(image string) corev1.PullPolicy {
+	if strings.Contains(image, "@") {
+		return corev1.PullIfNotPresent
+	}
+	name := image[strings.LastIndex(image, "/")+1:]
+	_, tag, found := strings.Cut(name, ":")
+	if !found || tag == "latest" {
+		return corev1.PullAlways
+	}
+	return corev1.PullIfNotPresent
+}
+
+func setProbeDefaults(p *corev1.Probe) {
+	if p.TimeoutSeconds == 0 {
+		p.TimeoutSeconds = 1
+	}
+	if p.PeriodSeconds == 0 {
+		p.PeriodSeconds = 10
+	}
+	if p.SuccessThreshold == 0 {
+		p.SuccessThreshold = 1
+	}
+	if p.FailureThreshold == 0 {
+		p.FailureThreshold = 3
+	}
+}
+
+func setReplicationControllerDefaults(rc *corev1.ReplicationController) {
+	if rc.Spec.Replicas == nil {
+		rc.Spec.Replicas = ptr.To(int32(1))
+	}
+	if rc.Spec.Template != nil {
+		setPodSpecDefaults(&rc.Spec.Template.Spec)
+	}
+}
+
+func setServiceDefaults(svc *corev1.Service) {
+	if svc.Spec.SessionAffinity == "" {
+		svc.Spec.SessionAffinity = corev1.ServiceAffinityNone
+	}
+	if svc.Spec.Type == "" {
+		svc.Spec.Type = corev1.ServiceTypeClusterIP
+	}
+	for i := range svc.Spec.Ports {
+		p := &svc.Spec.Ports[i]
+		if p.Protocol == "" {
+			p.Protocol = corev1.ProtocolTCP
+		}
+		if p.TargetPort == intstr.FromInt32(0) || p.TargetPort == intstr.FromString("") {
+			p.TargetPort = intstr.FromInt32(p.Port)
+		}
+	}
+	if svc.Spec.Type != corev1.ServiceTypeExternalName && svc.Spec.InternalTrafficPolicy == nil {
+		svc.Spec.InternalTrafficPolicy = ptr.To(corev1.ServiceInternalTrafficPolicyCluster)
+	}
+	if (svc.Spec.Type == corev1.ServiceTypeNodePort || svc.Spec.Type == corev1.ServiceTypeLoadBalancer) && svc.Spec.ExternalTrafficPolicy == "" {
+		svc.Spec.ExternalTrafficPolicy = corev1.ServiceExternalTrafficPolicyCluster
+	}
+	setServiceIPFamilyDefaults(svc)
+}
+
+// setServiceIPFamilyDefaults sets the IP families as the API server of an IPv4 single-stack cluster.
+// The cluster IPs are not allocated since they depend on the cluster.
+func setServiceIPFamilyDefaults(svc *corev1.Service) {
+	if svc.Spec.Type == corev1.ServiceTypeExternalName {
+		return
+	}
+	// The headless Services without selectors need no addresses, so they get both families.
+	if svc.Spec.ClusterIP == corev1.ClusterIPNone && len(svc.Spec.Selector) == 0 {
+		if svc.Spec.IPFamilyPolicy == nil {
+			svc.Spec.IPFamilyPolicy = ptr.To(corev1.IPFamilyPolicyRequireDualStack)
+		}
+		switch {
+		case len(svc.Spec.IPFamilies) == 0:
+			svc.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol}
+		case len(svc.Spec.IPFamilies) == 1 && *svc.Spec.IPFamilyPolicy != corev1.IPFamilyPolicySingleStack:
+			other := corev1.IPv6Protocol
+			if svc.Spec.IPFamilies[0] == corev1.IPv6Protocol {
+				other = corev1.IPv4Protocol
+			}
+			svc.Spec.IPFamilies = append(svc.Spec.IPFamilies, other)
+		}
+		return
+	}
+	if svc.Spec.IPFamilyPolicy == nil {
+		svc.Spec.IPFamilyPolicy = ptr.To(corev1.IPFamilyPolicySingleStack)
+	}
+	if len(svc.Spec.IPFamilies) == 0 {
+		svc.Spec.IPFamilies = []corev1.IPFamily{corev1.IPv4Protocol}
+	}
+}
+
+func setNamespaceDefaults(ns *corev1.Namespace) {
+	if ns.Labels == nil {
+		ns.Labels = map[string]string{}
+	}
+	ns.Labels[corev1.LabelMetadataName] = ns.Name
+}
+
+func setDeploymentDefaults(d *appsv1.Deployment) {
+	if d.Spec.Replicas == nil {
+		d.Spec.Replicas = ptr.To(int32(1))
+	}
+	if d.Spec.Strategy.Type == "" {
+		d.Spec.Strategy.Type = appsv1.RollingUpdateDeploymentStrategyType
+	}
+	if d.Spec.Strategy.Type == appsv1.RollingUpdateDeploymentStrategyType {
+		if d.Spec.Strategy.RollingUpdate == nil {
+			d.Spec.Strategy.RollingUpdate = &appsv1.RollingUpdateDeployment{}
+		}
+		if d.Spec.Strategy.RollingUpdate.MaxUnavailable == nil {
+			d.Spec.Strategy.RollingUpdate.MaxUnavailable = ptr.To(intstr.FromString("25%"))
+		}
+		if d.Spec.Strategy.RollingUpdate.MaxSurge == nil {
+			d.Spec.Strategy.RollingUpdate.MaxSurge = ptr.To(intstr.FromString("25%"))
+		}
+	}
+	if d.Spec.RevisionHistoryLimit == nil {
+		d.Spec.RevisionHistoryLimit = ptr.To(int32(10))
+	}
+	if d.Spec.ProgressDeadlineSeconds == nil {
+		d.Spec.ProgressDeadlineSeconds = ptr.To(int32(600))
+	}
+	setPodSpecDefaults(&d.Spec.Template.Spec)
+}
+
+func setReplicaSetDefaults(rs *appsv1.ReplicaSet) {
+	if rs.Spec.Replicas == nil {
+		rs.Spec.Replicas = ptr.To(int32(1))
+	}
+	setPodSpecDefaults(&rs.Spec.Template.Spec)
+}
+
+func setStatefulSetDefaults(s *appsv1.StatefulSet) {
+	if s.Spec.PodManagementPolicy == "" {
+		s.Spec.PodManagementPolicy = appsv1.OrderedReadyPodManagement
+	}
+	if s.Spec.UpdateStrategy.Type == "" {
+		s.Spec.UpdateStrategy.Type = appsv1.RollingUpdateStatefulSetStrategyType
+		if s.Spec.UpdateStrategy.RollingUpdate == nil {
+			s.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateStatefulSetStrategy{}
+		}
+	}
+	if s.Spec.UpdateStrategy.Type == appsv1.RollingUpdateStatefulSetStrategyType &&
+		s.Spec.UpdateStrategy.RollingUpdate != nil && s.Spec.UpdateStrategy.RollingUpdate.Partition == nil {
+		s.Spec.UpdateStrategy.RollingUpdate.Partition = ptr.To(int32(0))
+	}
+	if s.Spec.PersistentVolumeClaimRetentionPolicy == nil {
+		s.Spec.PersistentVolumeClaimRetentionPolicy = &appsv1.StatefulSetPersistentVolumeClaimRetentionPolicy{}
+	}
+	if s.Spec.PersistentVolumeClaimRetentionPolicy.WhenDeleted == "" {
+		s.Spec.PersistentVolumeClaimRetentionPolicy.WhenDeleted = appsv1.RetainPersistentVolumeClaimRetentionPolicyType
+	}
+	if s.Spec.PersistentVolumeClaimRetentionPolicy.WhenScaled == "" {
+		s.Spec.PersistentVolumeClaimRetentionPolicy.WhenScaled = appsv1.RetainPersistentVolumeClaimRetentionPolicyType
+	}
+	if s.Spec.Replicas == nil {
+		s.Spec.Replicas = ptr.To(int32(1))
+	}
+	if s.Spec.RevisionHistoryLimit == nil {
+		s.Spec.RevisionHistoryLimit = ptr.To(int32(10))
+	}
+	setPodSpecDefaults(&s.Spec.Template.Spec)
+}
+
+func setDaemonSetDefaults(ds *appsv1.DaemonSet) {
+	if ds.Spec.UpdateStrategy.Type == "" {
+		ds.Spec.UpdateStrategy.Type = appsv1.RollingUpdateDaemonSetStrategyType
+	}
+	if ds.Spec.UpdateStrategy.Type == appsv1.RollingUpdateDaemonSetStrategyType {
+		if ds.Spec.UpdateStrategy.RollingUpdate == nil {
+			ds.Spec.UpdateStrategy.RollingUpdate = &appsv1.RollingUpdateDaemonSet{}
+		}
+		if ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable == nil {
+			ds.Spec.UpdateStrategy.RollingUpdate.MaxUnavailable = ptr.To(intstr.FromInt32(1))
+		}
+		if ds.Spec.UpdateStrategy.RollingUpdate.MaxSurge == nil {
+			ds.Spec.UpdateStrategy.RollingUpdate.MaxSurge = ptr.To(intstr.FromInt32(0))
+		}
+	}
+	if ds.Spec.RevisionHistoryLimit == nil {
+		ds.Spec.RevisionHistoryLimit = ptr.To(int32(10))
+	}
+	setPodSpecDefaults(&ds.Spec.Template.Spec)
+}
+
+func setJobSpecDefaults(spec *batchv1.JobSpec) {
+	if spec.Completions == nil && spec.Parallelism == nil {
+		spec.Completions = ptr.To(int32(1))
+	}
+	if spec.Parallelism == nil {
+		spec.Parallelism = ptr.To(int32(1))
+	}
+	if spec.BackoffLimit == nil {
+		spec.BackoffLimit = ptr.To(int32(6))
+	}
+	if spec.CompletionMode == nil {
+		spec.CompletionMode = ptr.To(batchv1.NonIndexedCompletion)
+	}
+	if spec.Suspend == nil {
+		spec.Suspend = ptr.To(false)
+	}
+	if spec.PodReplacementPolicy == nil && spec.PodFailurePolicy == nil {
+		spec.PodReplacementPolicy = ptr.To(batchv1.TerminatingOrFailed)
+	}
+	setPodSpecDefaults(&spec.Template.Spec)
+}
+
+func setJobDefaults(j *batchv1.Job) {
+	setJobSpecDefaults(&j.Spec)
+}
+
+func setCronJobDefaults(cj *batchv1.CronJob) {
+	if cj.Spec.ConcurrencyPolicy == "" {
+		cj.Spec.ConcurrencyPolicy = batchv1.AllowConcurrent
+	}
+	if cj.Spec.Suspend == nil {
+		cj.Spec.Suspend = ptr.To(false)
+	}
+	if cj.Spec.SuccessfulJobsHistoryLimit == nil {
+		cj.Spec.SuccessfulJobsHistoryLimit = ptr.To(int32(3))
+	}
+	if cj.Spec.FailedJobsHistoryLimit == nil {
+		cj.Spec.FailedJobsHistoryLimit = ptr.To(int32(1))
+	}
+	// The job template is defaulted when the Job is created, except for the pod template.
+	setPodSpecDefaults(&cj.Spec.JobTemplate.Spec.Template.Spec)
+}
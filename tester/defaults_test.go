@@ -0,0 +1,184 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/utils/ptr"
+)
+
+func TestResourceLoader_ApplyDefaults(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	mustNil(t, loader.LoadResources([]string{"testdata/defaults.test/resources.yaml"}))
+	loader.ApplyDefaults()
+	get := func(group, kind, namespace, name string) *unstructured.Unstructured {
+		gvk := schema.GroupVersionKind{Group: group, Version: "v1", Kind: kind}
+		return loader.Resources[NewNameWithGVK(gvk, NamespacedName{Namespace: namespace, Name: name})]
+	}
+
+	deploy := get("apps", "Deployment", "default", "deploy")
+	pod := get("", "Pod", "default", "pod")
+	svc := get("", "Service", "default", "svc")
+	cm := get("", "ConfigMap", "", "cm")
+	custom := get("example.com", "Custom", "", "custom")
+	tests := []struct {
+		name   string
+		obj    *unstructured.Unstructured
+		fields []string
+		want   any
+	}{
+		{name: "ok: replicas", obj: deploy, fields: []string{"spec", "replicas"}, want: int64(1)},
+		{name: "ok: strategy", obj: deploy, fields: []string{"spec", "strategy", "rollingUpdate", "maxSurge"}, want: "25%"},
+		{name: "ok: restartPolicy", obj: deploy, fields: []string{"spec", "template", "spec", "restartPolicy"}, want: "Always"},
+		{name: "ok: unknown field is dropped", obj: deploy, fields: []string{"spec", "unknownField"}, want: nil},
+		{name: "ok: no creationTimestamp", obj: deploy, fields: []string{"metadata", "creationTimestamp"}, want: nil},
+		{name: "ok: requests of pod templates are not defaulted", obj: deploy, fields: []string{"spec", "template", "spec", "containers", "0", "resources", "requests"}, want: nil},
+		{name: "ok: requests are defaulted to limits", obj: pod, fields: []string{"spec", "containers", "0", "resources", "requests"}, want: map[string]any{"cpu": "500m", "memory": "64Mi"}},
+		{name: "ok: hostPort", obj: pod, fields: []string{"spec", "containers", "0", "ports", "0", "hostPort"}, want: int64(8080)},
+		{name: "ok: httpGet", obj: pod, fields: []string{"spec", "containers", "0", "readinessProbe", "httpGet"}, want: map[string]any{"path": "/", "port": int64(8080), "scheme": "HTTP"}},
+		{name: "ok: defaultMode", obj: pod, fields: []string{"spec", "volumes", "0", "secret", "defaultMode"}, want: int64(0o644)},
+		{name: "ok: emptyDir", obj: pod, fields: []string{"spec", "volumes", "1", "emptyDir"}, want: map[string]any{}},
+		{name: "ok: ipFamilyPolicy", obj: svc, fields: []string{"spec", "ipFamilyPolicy"}, want: "SingleStack"},
+		{name: "ok: ipFamilies", obj: svc, fields: []string{"spec", "ipFamilies"}, want: []any{"IPv4"}},
+		{name: "ok: kind without defaulter is left as it is", obj: cm, fields: []string{"unknownField"}, want: "x"},
+		{name: "ok: custom resource is left as it is", obj: custom, fields: []string{"spec", "unknownField"}, want: "x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := nestedField(tt.obj.Object, tt.fields...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s = %#v, want %#v", strings.Join(tt.fields, "."), got, tt.want)
+			}
+		})
+	}
+
+	containers, _, _ := unstructured.NestedSlice(deploy.Object, "spec", "template", "spec", "containers")
+	var policies []string
+	for _, c := range containers {
+		policies = append(policies, c.(map[string]any)["imagePullPolicy"].(string))
+	}
+	if want := []string{"Always", "IfNotPresent"}; !reflect.DeepEqual(policies, want) {
+		t.Errorf("imagePullPolicy = %v, want %v", policies, want)
+	}
+	ns := get("", "Namespace", "", "ns")
+	if got := ns.GetLabels()["kubernetes.io/metadata.name"]; got != "ns" {
+		t.Errorf("Namespace label = %q, want ns", got)
+	}
+	if _, err := loader.GetResource(NewNameWithGVK(schema.GroupVersionKind{Kind: "Deployment"}, NamespacedName{Name: "invalid"})); err == nil ||
+		!strings.HasPrefix(err.Error(), "Deployment:default/invalid: apply defaults: ") {
+		t.Errorf("GetResource() error = %v, want the error of the invalid Deployment", err)
+	}
+}
+
+// nestedField returns the field of the object at the path, where a number is an index of a list.
+func nestedField(obj any, fields ...string) any {
+	for _, f := range fields {
+		switch v := obj.(type) {
+		case map[string]any:
+			obj = v[f]
+		case []any:
+			i, err := strconv.Atoi(f)
+			if err != nil || i >= len(v) {
+				return nil
+			}
+			obj = v[i]
+		default:
+			return nil
+		}
+	}
+	return obj
+}
+
+func TestSetServiceIPFamilyDefaults(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		spec         corev1.ServiceSpec
+		wantPolicy   *corev1.IPFamilyPolicy
+		wantFamilies []corev1.IPFamily
+	}{
+		{
+			name:         "ok: ClusterIP",
+			spec:         corev1.ServiceSpec{Selector: map[string]string{"app": "a"}},
+			wantPolicy:   ptr.To(corev1.IPFamilyPolicySingleStack),
+			wantFamilies: []corev1.IPFamily{corev1.IPv4Protocol},
+		},
+		{
+			name:         "ok: headless with selector",
+			spec:         corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone, Selector: map[string]string{"app": "a"}},
+			wantPolicy:   ptr.To(corev1.IPFamilyPolicySingleStack),
+			wantFamilies: []corev1.IPFamily{corev1.IPv4Protocol},
+		},
+		{
+			name:         "ok: headless without selector",
+			spec:         corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone},
+			wantPolicy:   ptr.To(corev1.IPFamilyPolicyRequireDualStack),
+			wantFamilies: []corev1.IPFamily{corev1.IPv4Protocol, corev1.IPv6Protocol},
+		},
+		{
+			name:         "ok: headless without selector in a family",
+			spec:         corev1.ServiceSpec{ClusterIP: corev1.ClusterIPNone, IPFamilies: []corev1.IPFamily{corev1.IPv6Protocol}},
+			wantPolicy:   ptr.To(corev1.IPFamilyPolicyRequireDualStack),
+			wantFamilies: []corev1.IPFamily{corev1.IPv6Protocol, corev1.IPv4Protocol},
+		},
+		{
+			name: "ok: ExternalName",
+			spec: corev1.ServiceSpec{Type: corev1.ServiceTypeExternalName, ExternalName: "example.com"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			svc := &corev1.Service{Spec: tt.spec}
+			setServiceIPFamilyDefaults(svc)
+			if !reflect.DeepEqual(svc.Spec.IPFamilyPolicy, tt.wantPolicy) || !reflect.DeepEqual(svc.Spec.IPFamilies, tt.wantFamilies) {
+				t.Errorf("ipFamilyPolicy, ipFamilies = %v, %v, want %v, %v", svc.Spec.IPFamilyPolicy, svc.Spec.IPFamilies, tt.wantPolicy, tt.wantFamilies)
+			}
+		})
+	}
+}
+
+func TestDefaultImagePullPolicy(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{image: "nginx", want: "Always"},
+		{image: "nginx:latest", want: "Always"},
+		{image: "nginx:1.27", want: "IfNotPresent"},
+		{image: "example.com:5000/nginx", want: "Always"},
+		{image: "example.com:5000/nginx:1.27", want: "IfNotPresent"},
+		{image: "nginx@sha256:0123", want: "IfNotPresent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			t.Parallel()
+			if got := defaultImagePullPolicy(tt.image); string(got) != tt.want {
+				t.Errorf("defaultImagePullPolicy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// DefaultManifestPattern is the pattern of test manifests discovered in a directory.
+// It matches the manifests generated by `kaptest init`.
+const DefaultManifestPattern = "**/*.test/" + rootManifestName
+
+// recursiveSuffix is the suffix of a path to discover test manifests recursively like `./...`.
+const recursiveSuffix = "..."
+
+// UntestedPolicy is a ValidatingAdmissionPolicy which no test manifest has a test suite for.
+type UntestedPolicy struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// resolveManifests converts the paths given to `kaptest run` into the list of test manifests.
+// A directory or a path ending with "/..." is searched recursively for manifests matching opts.ManifestPattern.
+// Other paths are treated as test manifests as they are.
+// It also returns the directories which are searched.
+func resolveManifests(opts Options, paths []string) ([]string, []string, error) {
+	var manifests, roots []string
+	seen := map[string]struct{}{}
+	add := func(p string) {
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		manifests = append(manifests, p)
+	}
+
+	for _, p := range paths {
+		root, ok := searchRoot(p)
+		if !ok {
+			add(p)
+			continue
+		}
+		found, err := discoverManifests(opts, root)
+		if err != nil {
+			return nil, nil, fmt.Errorf("discover test manifests in %q: %w", root, err)
+		}
+		if len(found) == 0 {
+			return nil, nil, fmt.Errorf("no test manifest is found in %q", root)
+		}
+		for _, m := range found {
+			add(m)
+		}
+		roots = append(roots, root)
+	}
+	return manifests, roots, nil
+}
+
+// searchRoot returns the directory to be searched recursively if the path is a directory or ends with "/...".
+func searchRoot(p string) (string, bool) {
+	if p == recursiveSuffix {
+		return ".", true
+	}
+	if strings.HasSuffix(p, "/"+recursiveSuffix) {
+		return filepath.Clean(strings.TrimSuffix(p, recursiveSuffix)), true
+	}
+	if info, err := os.Stat(p); err == nil && info.IsDir() {
+		return filepath.Clean(p), true
+	}
+	return "", false
+}
+
+// discoverManifests returns the test manifests under the root directory in lexical order.
+// Both opts.ManifestPattern and opts.Ignore are matched against the paths relative to the root.
+// The manifest pattern is also matched against the paths prefixed with the name of the root,
+// so that the default pattern finds the manifest in a root such as "policy.test".
+func discoverManifests(opts Options, root string) ([]string, error) {
+	pattern := opts.ManifestPattern
+	if pattern == "" {
+		pattern = DefaultManifestPattern
+	}
+	for _, p := range append([]string{pattern}, opts.Ignore...) {
+		if _, err := filepath.Match(strings.ReplaceAll(p, "**", "*"), ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+	}
+
+	rootName := root
+	if abs, err := filepath.Abs(root); err == nil {
+		rootName = filepath.Base(abs)
+	}
+	var manifests []string
+	err := walkFiles(opts, root, func(path string) {
+		rel, _ := filepath.Rel(root, path)
+		if matchPattern(splitPath(pattern), splitPath(rel)) || matchPattern(splitPath(pattern), splitPath(filepath.Join(rootName, rel))) {
+			manifests = append(manifests, path)
+		}
+	})
+	return manifests, err
+}
+
+// walkFiles calls fn for each file under the root directory except ones whose paths relative to the root match opts.Ignore.
+func walkFiles(opts Options, root string, fn func(path string)) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if rel, _ := filepath.Rel(root, path); path != root && isIgnored(opts.Ignore, rel) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			fn(path)
+		}
+		return nil
+	})
+}
+
+func isIgnored(patterns []string, path string) bool {
+	for _, p := range patterns {
+		if matchPattern(splitPath(p), splitPath(path)) {
+			return true
+		}
+	}
+	return false
+}
+
+// findUntestedPolicies returns the policies defined in YAML files under the root directories
+// which have no test suite in the test manifests.
+// A policy is considered as tested when a manifest loads the policy file and has a test suite for it.
+func findUntestedPolicies(opts Options, roots, manifestPaths []string) ([]UntestedPolicy, error) {
+	tested := map[string]map[string]struct{}{} // file -> policy names
+	for _, m := range manifestPaths {
+		files, names, err := readManifestPolicies(m)
+		if err != nil {
+			// Broken manifests are reported as test failures.
+			continue
+		}
+		for _, f := range files {
+			if tested[f] == nil {
+				tested[f] = map[string]struct{}{}
+			}
+			for _, n := range names {
+				tested[f][n] = struct{}{}
+			}
+		}
+	}
+
+	var untested []UntestedPolicy
+	seen := map[string]struct{}{}
+	for _, root := range roots {
+		err := walkFiles(opts, root, func(path string) {
+			if !hasManifestExt(path) {
+				return
+			}
+			key := absPath(path)
+			if _, ok := seen[key]; ok {
+				return
+			}
+			seen[key] = struct{}{}
+			for _, name := range readPolicyNames(path) {
+				if _, ok := tested[key][name]; !ok {
+					untested = append(untested, UntestedPolicy{Name: name, Path: path})
+				}
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("search policies in %q: %w", root, err)
+		}
+	}
+	sort.SliceStable(untested, func(i, j int) bool {
+		if untested[i].Path != untested[j].Path {
+			return untested[i].Path < untested[j].Path
+		}
+		return untested[i].Name < untested[j].Name
+	})
+	return untested, nil
+}
+
+// readManifestPolicies returns the absolute paths of the policy files loaded by the manifest
+// and the names of the policies which have test suites.
+func readManifestPolicies(manifestPath string) ([]string, []string, error) {
+	buf, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var manifests TestManifests
+	if err := yaml.Unmarshal(buf, &manifests); err != nil {
+		return nil, nil, err
+	}
+	files, err := expandPaths(resolvePaths(filepath.Dir(manifestPath), manifests.ValidatingAdmissionPolicies))
+	if err != nil {
+		return nil, nil, err
+	}
+	for i, f := range files {
+		files[i] = absPath(f)
+	}
+	names := make([]string, len(manifests.TestSuites))
+	for i, s := range manifests.TestSuites {
+		names[i] = s.Policy
+	}
+	return files, names, nil
+}
+
+// readPolicyNames returns the names of ValidatingAdmissionPolicies in the YAML file.
+// Documents which cannot be decoded are ignored since the file may not be a Kubernetes manifest.
+func readPolicyNames(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var names []string
+	decoder := kyaml.NewYAMLToJSONDecoder(f)
+	for {
+		var obj metav1.PartialObjectMetadata
+		if err := decoder.Decode(&obj); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return names
+		}
+		if obj.Kind == "ValidatingAdmissionPolicy" && obj.Name != "" {
+			names = append(names, obj.Name)
+		}
+	}
+	return names
+}
+
+func absPath(p string) string {
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		return filepath.Clean(p)
+	}
+	return abs
+}
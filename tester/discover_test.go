@@ -0,0 +1,164 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+func TestResolveManifests(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		opts      Options
+		paths     []string
+		want      []string
+		wantRoots []string
+		wantErr   bool
+	}{
+		{
+			name:  "ok: file is used as it is",
+			paths: []string{"testdata/vap-standard-resources.test/invalid-no-obj.yaml"},
+			want:  []string{"testdata/vap-standard-resources.test/invalid-no-obj.yaml"},
+		},
+		{
+			name:  "ok: directory",
+			paths: []string{"testdata"},
+			want: []string{
+				"testdata/vap-custom-resources.test/kaptest.yaml",
+				"testdata/vap-standard-resources.test/kaptest.yaml",
+				"testdata/vap-with-admission-review.test/kaptest.yaml",
+				"testdata/vap-with-crds.test/kaptest.yaml",
+				"testdata/vap-with-namespace-object.test/kaptest.yaml",
+				"testdata/vap-with-namespaces.test/kaptest.yaml",
+				"testdata/vap-with-params.test/kaptest.yaml",
+				"testdata/vap-with-request-kind.test/kaptest.yaml",
+				"testdata/vap-with-snapshots.test/kaptest.yaml",
+				"testdata/vap-with-userinfo.test/kaptest.yaml",
+			},
+			wantRoots: []string{"testdata"},
+		},
+		{
+			name:      "ok: recursive suffix",
+			paths:     []string{"./testdata/vap-with-params.test/..."},
+			want:      []string{"testdata/vap-with-params.test/kaptest.yaml"},
+			wantRoots: []string{"testdata/vap-with-params.test"},
+		},
+		{
+			name:  "ok: ignore",
+			opts:  Options{Ignore: []string{"**/vap-with-*"}},
+			paths: []string{"testdata/..."},
+			want: []string{
+				"testdata/vap-custom-resources.test/kaptest.yaml",
+				"testdata/vap-standard-resources.test/kaptest.yaml",
+			},
+			wantRoots: []string{"testdata"},
+		},
+		{
+			name:  "ok: ignore relative to the root",
+			opts:  Options{Ignore: []string{"vap-with-*", "vap-custom-resources.test/kaptest.yaml"}},
+			paths: []string{"testdata"},
+			want: []string{
+				"testdata/vap-standard-resources.test/kaptest.yaml",
+			},
+			wantRoots: []string{"testdata"},
+		},
+		{
+			name:  "ok: manifest pattern",
+			opts:  Options{ManifestPattern: "**/vap-standard-resources.test/invalid-*.yaml"},
+			paths: []string{"testdata"},
+			want: []string{
+				"testdata/vap-standard-resources.test/invalid-no-obj.yaml",
+				"testdata/vap-standard-resources.test/invalid-no-policy.yaml",
+			},
+			wantRoots: []string{"testdata"},
+		},
+		{
+			name:  "ok: manifest pattern relative to the root",
+			opts:  Options{ManifestPattern: "vap-with-p*.test/kaptest.yaml"},
+			paths: []string{"testdata/..."},
+			want: []string{
+				"testdata/vap-with-params.test/kaptest.yaml",
+			},
+			wantRoots: []string{"testdata"},
+		},
+		{
+			name:    "err: no manifest found",
+			opts:    Options{ManifestPattern: "**/not-found.yaml"},
+			paths:   []string{"testdata"},
+			wantErr: true,
+		},
+		{
+			name:    "err: invalid pattern",
+			opts:    Options{Ignore: []string{"["}},
+			paths:   []string{"testdata"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, roots, err := resolveManifests(tt.opts, tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveManifests() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveManifests() manifests = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(roots, tt.wantRoots) {
+				t.Errorf("resolveManifests() roots = %v, want %v", roots, tt.wantRoots)
+			}
+		})
+	}
+}
+
+func TestFindUntestedPolicies(t *testing.T) {
+	t.Parallel()
+	y := printers.YAMLPrinter{}
+	dir := t.TempDir()
+
+	tested := sampleValidatingAdmissionPolicy()
+	untested := sampleValidatingAdmissionPolicy()
+	untested.Name = "untested-policy"
+	f, err := os.Create(filepath.Join(dir, "policy.yaml"))
+	mustNil(t, err)
+	mustNil(t, y.PrintObj(tested, f))
+	mustNil(t, RunInit(CmdConfig{}, filepath.Join(dir, "policy.yaml")))
+	// Add a policy after the test manifest is generated
+	mustNil(t, y.PrintObj(untested, f))
+
+	f, err = os.Create(filepath.Join(dir, "no-test.yaml"))
+	mustNil(t, err)
+	mustNil(t, y.PrintObj(tested, f))
+
+	manifests, roots, err := resolveManifests(Options{}, []string{dir})
+	mustNil(t, err)
+	got, err := findUntestedPolicies(Options{}, roots, manifests)
+	mustNil(t, err)
+
+	want := []UntestedPolicy{
+		{Name: "sample-policy", Path: filepath.Join(dir, "no-test.yaml")},
+		{Name: "untested-policy", Path: filepath.Join(dir, "policy.yaml")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("findUntestedPolicies() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,302 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pfnet/kaptest"
+	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	kyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// stdinPath is the path to read an object from stdin.
+const stdinPath = "-"
+
+// EvalOptions is the options of RunEval.
+type EvalOptions struct {
+	// Policies is the list of the files, directories or glob patterns of the policies to evaluate.
+	Policies []string
+	// Object is the path to the object. Each object is read from stdin if the path is "-".
+	Object string
+	// OldObject is the path to the old object.
+	OldObject string
+	// Params is the path to the param object of the policies with paramKind.
+	Params string
+	// Namespace is the path to the Namespace object of the object.
+	// A Namespace without labels and annotations is used if empty.
+	Namespace string
+	// UserInfo is the user who sends the request.
+	UserInfo UserInfo
+	// Output is the output format, either text or json.
+	Output OutputFormat
+}
+
+// EvalReport is the result of a policy evaluated against the object.
+type EvalReport struct {
+	Policy string `json:"policy"`
+	// Name is the human-readable name of the request, e.g. "(CREATE) Deployment:foo".
+	Name string `json:"name"`
+	// Operation is one of CREATE, UPDATE and DELETE.
+	Operation string       `json:"operation"`
+	Object    *NameWithGVK `json:"object,omitempty"`
+	OldObject *NameWithGVK `json:"oldObject,omitempty"`
+	// Result is one of admit, deny, error, skip, setup_error and fatal_error.
+	Result               Result                  `json:"result"`
+	Decisions            []DecisionReport        `json:"decisions,omitempty"`
+	AuditAnnotations     []AuditAnnotationReport `json:"auditAnnotations,omitempty"`
+	FailedMatchCondition string                  `json:"failedMatchCondition,omitempty"`
+	Errors               []string                `json:"errors,omitempty"`
+	ExpressionPosition   *Position               `json:"expressionPosition,omitempty"`
+}
+
+// RunEval evaluates the policies against the object without test manifests and writes the results to stdout.
+func RunEval(opts EvalOptions) error {
+	if opts.Output == "" {
+		opts.Output = OutputText
+	}
+	if opts.Output != OutputText && opts.Output != OutputJSON {
+		return fmt.Errorf("unsupported output format %q: must be text or json", opts.Output)
+	}
+	reports, err := Eval(opts, os.Stdin)
+	if err != nil {
+		return err
+	}
+	if opts.Output == OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+	writeEvalText(os.Stdout, reports)
+	return nil
+}
+
+// Eval evaluates the policies against the object and returns the results in the order of the policy names.
+// The objects given as "-" are read from stdin.
+func Eval(opts EvalOptions, stdin io.Reader) ([]EvalReport, error) {
+	if opts.Object == "" && opts.OldObject == "" {
+		return nil, errors.New("object or oldObject is required")
+	}
+	n := 0
+	for _, p := range []string{opts.Object, opts.OldObject, opts.Params, opts.Namespace} {
+		if p == stdinPath {
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, errors.New("only one object can be read from stdin")
+	}
+
+	loader := NewResourceLoader()
+	if err := loader.LoadVaps(opts.Policies); err != nil {
+		return nil, fmt.Errorf("load policies: %w", err)
+	}
+	if err := loader.check(); err != nil {
+		return nil, fmt.Errorf("load policies: %w", err)
+	}
+	if len(loader.Vaps) == 0 {
+		return nil, errors.New("no ValidatingAdmissionPolicy found")
+	}
+
+	obj, err := readObject(opts.Object, stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read object: %w", err)
+	}
+	oldObj, err := readObject(opts.OldObject, stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read oldObject: %w", err)
+	}
+	// The param and the namespace are looked up from the loader in the same way as the test cases.
+	tc := TestCase{UserInfo: opts.UserInfo}
+	if obj != nil {
+		tc.Object = NewNameWithGVKFromObj(obj)
+	}
+	if oldObj != nil {
+		tc.OldObject = NewNameWithGVKFromObj(oldObj)
+	}
+	params, err := readObject(opts.Params, stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read params: %w", err)
+	}
+	if params != nil {
+		loader.AddResource(params)
+		tc.Param = NamespacedName{Namespace: params.GetNamespace(), Name: params.GetName()}
+	}
+	namespace, err := readObject(opts.Namespace, stdin)
+	if err != nil {
+		return nil, fmt.Errorf("read namespace: %w", err)
+	}
+	if namespace != nil {
+		loader.AddResource(namespace)
+	}
+
+	// As the API server, the policies are evaluated only if the request matches spec.matchConstraints.
+	userInfo := NewK8sUserInfo(tc.UserInfo)
+	req := givenRequest(kaptest.ValidationParams{Object: obj, OldObject: oldObj, UserInfo: &userInfo})
+	namespaceObj, nsErr := getNamespaceObj(loader, obj, oldObj)
+
+	names := make([]string, 0, len(loader.Vaps))
+	for name := range loader.Vaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	reports := make([]EvalReport, 0, len(names))
+	for _, name := range names {
+		vap := loader.Vaps[name]
+		c := evalMatchedPolicy(vap, tc, loader, req, namespaceObj, nsErr, obj, oldObj)
+		loader.vapPositions[name].annotate(&c)
+		reports = append(reports, EvalReport{
+			Policy:               name,
+			Name:                 c.Name,
+			Operation:            c.Operation,
+			Object:               c.Object,
+			OldObject:            c.OldObject,
+			Result:               c.Result,
+			Decisions:            c.Decisions,
+			AuditAnnotations:     c.AuditAnnotations,
+			FailedMatchCondition: c.FailedMatchCondition,
+			Errors:               c.Errors,
+			ExpressionPosition:   c.ExpressionPosition,
+		})
+	}
+	return reports, nil
+}
+
+// evalMatchedPolicy evaluates the policy against the request if the request matches spec.matchConstraints of the policy.
+// The request is not matched if the namespace cannot be found, and the error is reported by newEvalParams instead.
+func evalMatchedPolicy(vap *v1.ValidatingAdmissionPolicy, tc TestCase, loader *ResourceLoader, req *admissionRequest,
+	namespaceObj *corev1.Namespace, nsErr error, obj, oldObj *unstructured.Unstructured,
+) CaseReport {
+	if nsErr == nil {
+		matched, err := matchRequest(req, namespaceObj, vap.Spec.MatchConstraints)
+		if err != nil {
+			return newSetupErrorResult(tc, []error{fmt.Errorf("match spec.matchConstraints: %w", err)})
+		}
+		if !matched {
+			return newPolicyNotMatchedResult(tc)
+		}
+	}
+	given, errs := newEvalParams(vap, tc, loader, obj, oldObj)
+	if len(errs) > 0 {
+		return newSetupErrorResult(tc, errs)
+	}
+	return evalPolicy(vap, kaptest.NewValidator(vap), tc, given)
+}
+
+// newEvalParams returns the params to evaluate the policy against the given objects.
+// Unlike newValidationParams, the objects are not looked up from the loader since they can have the same name.
+func newEvalParams(vap *v1.ValidatingAdmissionPolicy, tc TestCase, loader *ResourceLoader, obj, oldObj *unstructured.Unstructured) (kaptest.ValidationParams, []error) {
+	var errs []error
+	var paramObj *unstructured.Unstructured
+	var err error
+	if vap.Spec.ParamKind != nil && !tc.Param.IsValid() {
+		errs = append(errs, errors.New("params are required by spec.paramKind"))
+	} else if paramObj, err = getParamObj(loader, vap, tc.Param); err != nil {
+		errs = append(errs, fmt.Errorf("get param: %w", err))
+	}
+	namespaceObj, err := getNamespaceObj(loader, obj, oldObj)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("get namespace: %w", err))
+	}
+	if len(errs) > 0 {
+		return kaptest.ValidationParams{}, errs
+	}
+	userInfo := NewK8sUserInfo(tc.UserInfo)
+	return kaptest.ValidationParams{
+		Object:       obj,
+		OldObject:    oldObj,
+		ParamObj:     paramObj,
+		NamespaceObj: namespaceObj,
+		UserInfo:     &userInfo,
+	}, nil
+}
+
+// readObject reads a single object from the file, or stdin if the path is "-".
+// It returns nil if the path is empty, and an error if the object lacks apiVersion, kind or metadata.name.
+func readObject(path string, stdin io.Reader) (*unstructured.Unstructured, error) {
+	if path == "" {
+		return nil, nil
+	}
+	r := stdin
+	if path != stdinPath {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	decoder := kyaml.NewYAMLOrJSONDecoder(r, 4096)
+	var obj *unstructured.Unstructured
+	for {
+		var m map[string]any
+		if err := decoder.Decode(&m); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decode: %w", err)
+		}
+		if len(m) == 0 {
+			continue
+		}
+		if obj != nil {
+			return nil, errors.New("multiple objects found")
+		}
+		obj = &unstructured.Unstructured{Object: m}
+	}
+	if obj == nil {
+		return nil, errors.New("no object found")
+	}
+	if err := validateResource(obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// writeEvalText writes the results of Eval in the human-readable format.
+func writeEvalText(w io.Writer, reports []EvalReport) {
+	var b strings.Builder
+	for _, r := range reports {
+		c := CaseReport{
+			Result:               r.Result,
+			Decisions:            r.Decisions,
+			FailedMatchCondition: r.FailedMatchCondition,
+			Errors:               r.Errors,
+		}
+		fmt.Fprintf(&b, "%s - %s ==> %s\n", r.Policy, r.Name, resultLabel(r.Result))
+		for _, l := range caseDetailLines(c) {
+			b.WriteString("--- " + l + "\n")
+		}
+		for _, a := range r.AuditAnnotations {
+			if a.Error != "" {
+				fmt.Fprintf(&b, "--- AUDIT ANNOTATION: key %q, error %q\n", a.Key, a.Error)
+			} else {
+				fmt.Fprintf(&b, "--- AUDIT ANNOTATION: key %q, value %q\n", a.Key, a.Value)
+			}
+		}
+	}
+	_, _ = io.WriteString(w, b.String())
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	t.Parallel()
+	path := func(name string) string { return filepath.Join("testdata/eval.test", name) }
+	bad, err := os.ReadFile(path("bad.yaml"))
+	mustNil(t, err)
+
+	tests := []struct {
+		name    string
+		opts    EvalOptions
+		stdin   string
+		want    []Result
+		wantErr string
+	}{
+		{
+			name: "ok: namespace",
+			opts: EvalOptions{Policies: []string{"testdata/vap-with-namespaces.yaml"}, Object: path("ok.yaml"), Namespace: path("namespace.yaml")},
+			want: []Result{ResultAdmit},
+		},
+		{
+			name: "ok: default namespace",
+			opts: EvalOptions{Policies: []string{"testdata/vap-with-namespaces.yaml"}, Object: path("ok.yaml")},
+			want: []Result{ResultDeny},
+		},
+		{
+			name:  "ok: stdin",
+			opts:  EvalOptions{Policies: []string{"testdata/vap-with-namespaces.yaml"}, Object: "-", Namespace: path("namespace.yaml")},
+			stdin: string(bad),
+			want:  []Result{ResultDeny},
+		},
+		{
+			name: "ok: params",
+			opts: EvalOptions{Policies: []string{"testdata/vap-with-params.yaml"}, Object: path("bad.yaml"), OldObject: path("ok.yaml"), Params: path("params.yaml")},
+			want: []Result{ResultDeny},
+		},
+		{
+			name: "ok: policies not matching the request are skipped",
+			opts: EvalOptions{Policies: []string{"testdata/vap-standard-resources.yaml"}, Object: path("ok.yaml")},
+			want: []Result{ResultSkip, ResultSkip, ResultAdmit, ResultAdmit},
+		},
+		{
+			name: "ok: params are missing",
+			opts: EvalOptions{Policies: []string{"testdata/vap-with-params.yaml"}, Object: path("ok.yaml")},
+			want: []Result{ResultSetupError},
+		},
+		{
+			name:    "err: no object",
+			opts:    EvalOptions{Policies: []string{"testdata/vap-with-params.yaml"}},
+			wantErr: "object or oldObject is required",
+		},
+		{
+			name:    "err: multiple stdin",
+			opts:    EvalOptions{Policies: []string{"testdata/vap-with-params.yaml"}, Object: "-", OldObject: "-"},
+			wantErr: "only one object can be read from stdin",
+		},
+		{
+			name:    "err: multiple objects",
+			opts:    EvalOptions{Policies: []string{"testdata/vap-with-params.yaml"}, Object: path("multiple.yaml")},
+			wantErr: "multiple objects found",
+		},
+		{
+			name:    "err: invalid object",
+			opts:    EvalOptions{Policies: []string{"testdata/vap-with-params.yaml"}, Object: path("kind-only.yaml")},
+			wantErr: "read object: Deployment has no apiVersion, metadata.name",
+		},
+		{
+			name:    "err: invalid namespace",
+			opts:    EvalOptions{Policies: []string{"testdata/vap-with-params.yaml"}, Object: path("ok.yaml"), Namespace: path("no-name.yaml")},
+			wantErr: "read namespace: Namespace has no metadata.name",
+		},
+		{
+			name:    "err: no policy",
+			opts:    EvalOptions{Policies: []string{path("ok.yaml")}, Object: path("ok.yaml")},
+			wantErr: "no ValidatingAdmissionPolicy found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			reports, err := Eval(tt.opts, strings.NewReader(tt.stdin))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Eval() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			mustNil(t, err)
+			var got []Result
+			for _, r := range reports {
+				got = append(got, r.Result)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("Eval() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("Eval() = %v, want %v: %+v", got, tt.want, reports)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteEvalText(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	writeEvalText(&out, []EvalReport{
+		{Policy: "a", Name: "(CREATE) Deployment:foo", Result: ResultAdmit, Decisions: []DecisionReport{{Evaluation: ResultAdmit}}},
+		{
+			Policy:           "b",
+			Name:             "(CREATE) Deployment:foo",
+			Result:           ResultDeny,
+			Decisions:        []DecisionReport{{Evaluation: ResultDeny, Reason: "Invalid", Message: "denied"}},
+			AuditAnnotations: []AuditAnnotationReport{{Key: "k", Value: "v"}},
+		},
+	})
+	want := `a - (CREATE) Deployment:foo ==> ADMIT
+b - (CREATE) Deployment:foo ==> DENY
+--- DENY: reason "Invalid", message "denied"
+--- AUDIT ANNOTATION: key "k", value "v"
+`
+	if got := out.String(); got != want {
+		t.Errorf("writeEvalText() = %q, want %q", got, want)
+	}
+}
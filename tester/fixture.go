@@ -0,0 +1,48 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/managedfields"
+	"k8s.io/client-go/applyconfigurations"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+)
+
+// builtinTypeConverter validates the built-in objects against the schemas of the Kubernetes API embedded in client-go.
+// It is created on the first use since parsing the schemas takes time.
+var builtinTypeConverter = sync.OnceValue(func() managedfields.TypeConverter {
+	return applyconfigurations.NewTypeConverter(clientgoscheme.Scheme)
+})
+
+// ValidateFixtures validates the loaded built-in objects against the schemas of the Kubernetes API,
+// e.g. a string in an integer field or an unknown field, which the API server rejects before admission.
+// An invalid object is kept, and GetResource returns an error for it so that the test cases using it fail.
+// The objects of the other kinds are not validated.
+func (r *ResourceLoader) ValidateFixtures() {
+	for _, k := range r.sortedResourceKeys() {
+		obj := r.Resources[k]
+		if !clientgoscheme.Scheme.Recognizes(obj.GroupVersionKind()) {
+			continue
+		}
+		if _, err := builtinTypeConverter().ObjectToTyped(obj); err != nil {
+			r.invalid[k] = fmt.Errorf("invalid %s: %w", obj.GetKind(), err)
+		}
+	}
+}
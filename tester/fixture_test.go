@@ -0,0 +1,69 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"path/filepath"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestResourceLoader_ValidateFixtures(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{
+			name: "ok: valid Deployment",
+			path: "valid.yaml",
+		},
+		{
+			name: "ok: custom resource is not validated",
+			path: "custom-resource.yaml",
+		},
+		{
+			name:    "err: string in integer field",
+			path:    "string-in-integer.yaml",
+			wantErr: `Deployment:d: invalid Deployment: .spec.replicas: expected numeric (int or float), got string`,
+		},
+		{
+			name:    "err: unknown field",
+			path:    "unknown-field.yaml",
+			wantErr: `Deployment:d: invalid Deployment: .spec.replica: field not declared in schema`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			loader := NewResourceLoader()
+			mustNil(t, loader.LoadResources([]string{filepath.Join("testdata/validate-fixtures.test", tt.path)}))
+			loader.ValidateFixtures()
+
+			_, err := loader.GetResource(NewNameWithGVK(schema.GroupVersionKind{Kind: "Deployment"}, NamespacedName{Name: "d"}))
+			if tt.wantErr == "" {
+				mustNil(t, err)
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("GetResource() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,448 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kyaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+type ResourceLoader struct {
+	Vaps map[string]*v1.ValidatingAdmissionPolicy
+	// Resources is the loaded resources. Use AddResource to add a resource so that GetResource can find it.
+	Resources map[NameWithGVK]*unstructured.Unstructured
+	// Issues is the problems found by LoadVaps and LoadResources. See Err.
+	Issues []LoadIssue
+	// StrictNamespaces makes the lookups of the Namespaces of the objects fail if they are not loaded,
+	// instead of using Namespaces without labels and annotations.
+	StrictNamespaces bool
+	// vapPositions is the positions of the policies and their expressions keyed by name.
+	vapPositions map[string]*policyPositions
+	// index is the keys of Resources grouped by kind and name, which NameWithGVK.Match always requires to be equal.
+	index map[resourceKey][]NameWithGVK
+	// vapSources and resourceSources are the documents where the policies and the resources are loaded from,
+	// which are used to report duplicate definitions.
+	vapSources      map[string]documentRef
+	resourceSources map[NameWithGVK]documentRef
+	// crds is the loaded CustomResourceDefinitions keyed by the group and kind of the custom resources.
+	crds map[schema.GroupKind]*customResourceDefinition
+	// crdProcessed is the CustomResourceDefinitions and the custom resources already processed by applyCustomResourceDefinitions.
+	crdProcessed map[NameWithGVK]bool
+	// invalid is the errors of the resources rejected by ValidateFixtures, ApplyDefaults or their CustomResourceDefinitions.
+	invalid map[NameWithGVK]error
+}
+
+type resourceKey struct {
+	kind string
+	name string
+}
+
+// LoadIssueSeverity is the severity of LoadIssue, either error or warning.
+type LoadIssueSeverity string
+
+const (
+	// LoadIssueError makes the tests in the manifest fail.
+	LoadIssueError LoadIssueSeverity = "error"
+	// LoadIssueWarning is reported without failing the tests unless warnings are treated as errors.
+	LoadIssueWarning LoadIssueSeverity = "warning"
+)
+
+// LoadIssue is a problem found while loading the policies and the resources,
+// e.g. an unreadable file, an undecodable document or a duplicate definition.
+type LoadIssue struct {
+	Severity LoadIssueSeverity `json:"severity"`
+	Path     string            `json:"path"`
+	// Document is the 1-based index of the document in the file. It is zero if the issue is about the whole file.
+	Document int    `json:"document,omitempty"`
+	Message  string `json:"message"`
+}
+
+func (i LoadIssue) String() string {
+	return documentRef{path: i.Path, document: i.Document}.String() + ": " + i.Message
+}
+
+// documentRef is a document in a file.
+type documentRef struct {
+	path     string
+	document int
+}
+
+func (d documentRef) String() string {
+	if d.document == 0 {
+		return d.path
+	}
+	return fmt.Sprintf("%s (document %d)", d.path, d.document)
+}
+
+func NewResourceLoader() *ResourceLoader {
+	return &ResourceLoader{
+		Vaps:            map[string]*v1.ValidatingAdmissionPolicy{},
+		Resources:       map[NameWithGVK]*unstructured.Unstructured{},
+		vapPositions:    map[string]*policyPositions{},
+		index:           map[resourceKey][]NameWithGVK{},
+		vapSources:      map[string]documentRef{},
+		resourceSources: map[NameWithGVK]documentRef{},
+		crds:            map[schema.GroupKind]*customResourceDefinition{},
+		crdProcessed:    map[NameWithGVK]bool{},
+		invalid:         map[NameWithGVK]error{},
+	}
+}
+
+func (r *ResourceLoader) addIssue(severity LoadIssueSeverity, at documentRef, format string, args ...any) {
+	r.Issues = append(r.Issues, LoadIssue{Severity: severity, Path: at.path, Document: at.document, Message: fmt.Sprintf(format, args...)})
+}
+
+// Err returns an error describing the issues with the error severity, or the warnings as well if warningsAsErrors is true.
+// It returns nil if there is no such issue.
+func (r *ResourceLoader) Err(warningsAsErrors bool) error {
+	var msgs []string
+	warnings := 0
+	for _, i := range r.Issues {
+		if i.Severity == LoadIssueError {
+			msgs = append(msgs, i.String())
+		} else {
+			warnings++
+		}
+	}
+	if warningsAsErrors && warnings > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d warning(s) are treated as errors", warnings))
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(msgs, "; "))
+}
+
+// check logs the warnings and returns the errors of the issues for the commands without test manifests.
+func (r *ResourceLoader) check() error {
+	for _, i := range r.Issues {
+		if i.Severity == LoadIssueWarning {
+			slog.Warn(i.Message, "path", i.Path, "document", i.Document)
+		}
+	}
+	return r.Err(false)
+}
+
+// LoadVaps loads ValidatingAdmissionPolicies from the given paths.
+// Each path can be a file, a directory or a glob pattern (see expandPaths).
+// It returns an error if a path matches no file. Other problems are recorded in Issues.
+func (r *ResourceLoader) LoadVaps(paths []string) error {
+	files, err := expandPaths(paths)
+	if err != nil {
+		return err
+	}
+	for _, filePath := range files {
+		buf, err := os.ReadFile(filePath)
+		if err != nil {
+			r.addIssue(LoadIssueError, documentRef{path: filePath}, "read file: %v", err)
+			continue
+		}
+		positions := parsePolicyPositions(filePath, buf)
+		decoder := kyaml.NewYAMLToJSONDecoder(bytes.NewReader(buf))
+		for n := 1; ; n++ {
+			at := documentRef{path: filePath, document: n}
+			var doc json.RawMessage
+			if err := decoder.Decode(&doc); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				r.addIssue(LoadIssueError, at, "decode ValidatingAdmissionPolicy: %v", err)
+				continue
+			}
+			vap := r.decodeVap(at, doc)
+			if vap == nil {
+				continue
+			}
+			if prev, ok := r.vapSources[vap.Name]; ok {
+				r.addIssue(LoadIssueWarning, at, "ValidatingAdmissionPolicy %q is already defined in %s and is overridden", vap.Name, prev)
+			}
+			r.vapSources[vap.Name] = at
+			r.Vaps[vap.Name] = vap
+			r.vapPositions[vap.Name] = positions[vap.Name]
+		}
+	}
+	for k := range r.Vaps {
+		slog.Debug("ValidatingAdmissionPolicy laoded:", "name", k)
+	}
+	return nil
+}
+
+// decodeVap decodes the document into a v1 ValidatingAdmissionPolicy from the declared version.
+// It returns nil if the document is not a ValidatingAdmissionPolicy or cannot be decoded.
+// The fields unknown to the declared version are dropped with a warning.
+func (r *ResourceLoader) decodeVap(at documentRef, doc []byte) *v1.ValidatingAdmissionPolicy {
+	var meta metav1.TypeMeta
+	if err := json.Unmarshal(doc, &meta); err != nil || meta.Kind != "ValidatingAdmissionPolicy" {
+		slog.Debug("skipped non-ValidatingAdmissionPolicy resource", "kind", meta.Kind)
+		return nil
+	}
+	if gv, err := schema.ParseGroupVersion(meta.APIVersion); err != nil || !isPolicyVersion(gv) {
+		r.addIssue(LoadIssueError, at, "unsupported apiVersion %q of ValidatingAdmissionPolicy: must be one of %v", meta.APIVersion, policyVersions)
+		return nil
+	}
+	obj, warnings, err := decodePolicyObject(doc, meta.APIVersion)
+	if err != nil {
+		r.addIssue(LoadIssueError, at, "decode ValidatingAdmissionPolicy: %v", err)
+		return nil
+	}
+	for _, w := range warnings {
+		r.addIssue(LoadIssueWarning, at, "%s", w)
+	}
+	vap, err := toV1Policy(obj)
+	if err != nil {
+		r.addIssue(LoadIssueError, at, "%v", err)
+		return nil
+	}
+	return vap
+}
+
+// LoadResources loads resources from the given paths.
+// Each path can be a file, a directory or a glob pattern (see expandPaths).
+// A file can have multiple YAML documents, JSON objects or JSON arrays of objects, and the items of Lists are loaded.
+// It returns an error if a path matches no file. Other problems, e.g. an object without apiVersion, kind or metadata.name,
+// are recorded in Issues.
+// The loaded custom resources are processed with the loaded CustomResourceDefinitions.
+func (r *ResourceLoader) LoadResources(paths []string) error {
+	_, err := r.loadResources(paths)
+	return err
+}
+
+// loadResources loads resources from the given paths as LoadResources, and returns the objects in the files.
+func (r *ResourceLoader) loadResources(paths []string) ([]*unstructured.Unstructured, error) {
+	files, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	var objs []*unstructured.Unstructured
+	for _, filePath := range files {
+		objs = append(objs, r.loadResourceFile(filePath)...)
+	}
+	r.applyCustomResourceDefinitions()
+	for k := range r.Resources {
+		slog.Debug("Resource loaded:", "name", k)
+	}
+	return objs, nil
+}
+
+// AddResource adds the resource to the loader. A resource with the same GVK, namespace and name is replaced.
+// A custom resource is processed with the loaded CustomResourceDefinitions as LoadResources.
+func (r *ResourceLoader) AddResource(obj *unstructured.Unstructured) {
+	r.addResource(obj)
+	gvk := obj.GroupVersionKind()
+	if _, ok := r.crds[gvk.GroupKind()]; ok || gvk == crdGVK {
+		r.applyCustomResourceDefinitions()
+	}
+}
+
+func (r *ResourceLoader) addResource(obj *unstructured.Unstructured) {
+	ngvk := NewNameWithGVKFromObj(obj)
+	if _, ok := r.Resources[ngvk]; !ok {
+		key := resourceKey{kind: ngvk.Kind, name: ngvk.Name}
+		r.index[key] = append(r.index[key], ngvk)
+	}
+	r.Resources[ngvk] = obj
+	delete(r.crdProcessed, ngvk)
+}
+
+// GetResource returns the resource matching the query in the manner of NameWithGVK.Match.
+// It returns nil if no resource matches, and an error listing the candidates if multiple resources match.
+// It also returns an error if the resource is rejected by ValidateFixtures, ApplyDefaults or its CustomResourceDefinition.
+func (r *ResourceLoader) GetResource(ngvk NameWithGVK) (*unstructured.Unstructured, error) {
+	var matched []NameWithGVK
+	for _, k := range r.index[resourceKey{kind: ngvk.Kind, name: ngvk.Name}] {
+		if ngvk.Match(k) {
+			matched = append(matched, k)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, nil
+	case 1:
+		if err := r.invalid[matched[0]]; err != nil {
+			return nil, fmt.Errorf("%s: %w", matched[0].String(), err)
+		}
+		return r.Resources[matched[0]], nil
+	}
+	candidates := make([]string, len(matched))
+	for i, k := range matched {
+		candidates[i] = schema.GroupVersion{Group: k.Group, Version: k.Version}.String() + " " + k.String()
+	}
+	sort.Strings(candidates)
+	return nil, fmt.Errorf("multiple target resources found for %s: [%s]; specify namespace, group or version to select one",
+		ngvk.String(), strings.Join(candidates, ", "))
+}
+
+func (r *ResourceLoader) sortedResourceKeys() []NameWithGVK {
+	keys := make([]NameWithGVK, 0, len(r.Resources))
+	for k := range r.Resources {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessResourceKey(keys[i], keys[j]) })
+	return keys
+}
+
+// lessResourceKey orders the resources by group, version, kind, namespace and name.
+func lessResourceKey(a, b NameWithGVK) bool {
+	return slices.Compare(
+		[]string{a.Group, a.Version, a.Kind, a.Namespace, a.Name},
+		[]string{b.Group, b.Version, b.Kind, b.Namespace, b.Name},
+	) < 0
+}
+
+// loadResourceFile loads the objects in the YAML or JSON file and returns them.
+func (r *ResourceLoader) loadResourceFile(path string) []*unstructured.Unstructured {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		r.addIssue(LoadIssueError, documentRef{path: path}, "read file: %v", err)
+		return nil
+	}
+
+	// A JSON stream cannot be decoded after a syntax error while YAML documents can be skipped.
+	isJSON := kyaml.IsJSONBuffer(buf)
+	var decoder interface{ Decode(any) error }
+	if isJSON {
+		decoder = json.NewDecoder(bytes.NewReader(buf))
+	} else {
+		decoder = kyaml.NewYAMLToJSONDecoder(bytes.NewReader(buf))
+	}
+	var objs []*unstructured.Unstructured
+	for n := 1; ; n++ {
+		at := documentRef{path: path, document: n}
+		var doc any
+		if err := decoder.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			r.addIssue(LoadIssueError, at, "decode resource: %v", err)
+			if isJSON {
+				break
+			}
+			continue
+		}
+		var items []any
+		switch d := doc.(type) {
+		case nil:
+			continue
+		case []any:
+			items = d
+		default:
+			items = []any{d}
+		}
+		for i, item := range items {
+			m, ok := item.(map[string]any)
+			if !ok {
+				r.addIssue(LoadIssueError, at, "item %d is not an object", i)
+				continue
+			}
+			for _, obj := range unpackList(&unstructured.Unstructured{Object: m}) {
+				if err := validateResource(obj); err != nil {
+					r.addIssue(LoadIssueError, at, "%v", err)
+					continue
+				}
+				ngvk := NewNameWithGVKFromObj(obj)
+				if prev, ok := r.resourceSources[ngvk]; ok {
+					r.addIssue(LoadIssueWarning, at, "%s %s is already defined in %s and is overridden",
+						obj.GetAPIVersion(), ngvk.String(), prev)
+				}
+				r.resourceSources[ngvk] = at
+				r.addResource(obj)
+				if isBinding(obj.GroupVersionKind()) {
+					r.checkBinding(at, obj)
+				}
+				objs = append(objs, obj)
+			}
+		}
+	}
+	return objs
+}
+
+// checkBinding records the problems of the ValidatingAdmissionPolicyBinding in the same way as the policies.
+func (r *ResourceLoader) checkBinding(at documentRef, obj *unstructured.Unstructured) {
+	_, warnings, err := toV1Binding(obj)
+	if err != nil {
+		r.addIssue(LoadIssueError, at, "decode ValidatingAdmissionPolicyBinding: %v", err)
+		return
+	}
+	for _, w := range warnings {
+		r.addIssue(LoadIssueWarning, at, "%s", w)
+	}
+}
+
+// unpackList returns the items of the List, e.g. `kind: List` or `kind: DeploymentList`, or the object itself.
+// The items of a typed list without apiVersion and kind inherit them from the list.
+// An object of another kind with an items field, e.g. a custom resource, is not a List.
+func unpackList(obj *unstructured.Unstructured) []*unstructured.Unstructured {
+	if !strings.HasSuffix(obj.GetKind(), "List") || !obj.IsList() {
+		return []*unstructured.Unstructured{obj}
+	}
+	list, err := obj.ToList()
+	if err != nil {
+		return []*unstructured.Unstructured{obj}
+	}
+	itemKind := strings.TrimSuffix(obj.GetKind(), "List")
+	objs := make([]*unstructured.Unstructured, 0, len(list.Items))
+	for i := range list.Items {
+		item := &list.Items[i]
+		if item.GetKind() == "" && itemKind != "" {
+			item.SetKind(itemKind)
+		}
+		if item.GetAPIVersion() == "" {
+			item.SetAPIVersion(obj.GetAPIVersion())
+		}
+		objs = append(objs, unpackList(item)...)
+	}
+	return objs
+}
+
+// validateResource returns an error if the object cannot be identified.
+func validateResource(obj *unstructured.Unstructured) error {
+	var missing []string
+	if obj.GetAPIVersion() == "" {
+		missing = append(missing, "apiVersion")
+	}
+	if obj.GetKind() == "" {
+		missing = append(missing, "kind")
+	}
+	if obj.GetName() == "" {
+		missing = append(missing, "metadata.name")
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	desc := "object"
+	if obj.GetKind() != "" {
+		desc = obj.GetKind()
+	}
+	if obj.GetName() != "" {
+		desc += fmt.Sprintf(" %q", obj.GetName())
+	}
+	return fmt.Errorf("%s has no %s", desc, strings.Join(missing, ", "))
+}
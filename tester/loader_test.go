@@ -0,0 +1,304 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func newUnstructured(apiVersion, kind, namespace, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	return obj
+}
+
+func TestResourceLoader_GetResource(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	loader.AddResource(newUnstructured("apps/v1", "Deployment", "default", "foo"))
+	loader.AddResource(newUnstructured("apps/v1", "Deployment", "other", "foo"))
+	loader.AddResource(newUnstructured("apps/v1", "Deployment", "default", "bar"))
+	loader.AddResource(newUnstructured("example.com/v1", "Deployment", "default", "bar"))
+	loader.AddResource(newUnstructured("v1", "Namespace", "", "default"))
+	// Replacing a resource does not make the lookup ambiguous.
+	loader.AddResource(newUnstructured("v1", "Namespace", "", "default"))
+
+	tests := []struct {
+		name           string
+		query          NameWithGVK
+		wantNamespace  string
+		wantAPIVersion string
+		wantNil        bool
+		wantErr        []string
+	}{
+		{
+			name:           "ok: namespace",
+			query:          NameWithGVK{GVK: GVK{Kind: "Deployment"}, NamespacedName: NamespacedName{Namespace: "other", Name: "foo"}},
+			wantNamespace:  "other",
+			wantAPIVersion: "apps/v1",
+		},
+		{
+			name:           "ok: group",
+			query:          NameWithGVK{GVK: GVK{Group: "example.com", Kind: "Deployment"}, NamespacedName: NamespacedName{Name: "bar"}},
+			wantNamespace:  "default",
+			wantAPIVersion: "example.com/v1",
+		},
+		{
+			name:           "ok: cluster-scoped resource",
+			query:          NameWithGVK{GVK: GVK{Kind: "Namespace"}, NamespacedName: NamespacedName{Name: "default"}},
+			wantAPIVersion: "v1",
+		},
+		{
+			name:    "ok: not found",
+			query:   NameWithGVK{GVK: GVK{Kind: "Deployment"}, NamespacedName: NamespacedName{Name: "baz"}},
+			wantNil: true,
+		},
+		{
+			name:    "ok: version mismatch",
+			query:   NameWithGVK{GVK: GVK{Group: "apps", Version: "v2", Kind: "Deployment"}, NamespacedName: NamespacedName{Name: "bar"}},
+			wantNil: true,
+		},
+		{
+			name:    "err: ambiguous namespace",
+			query:   NameWithGVK{GVK: GVK{Kind: "Deployment"}, NamespacedName: NamespacedName{Name: "foo"}},
+			wantErr: []string{"apps/v1 Deployment:default/foo", "apps/v1 Deployment:other/foo"},
+		},
+		{
+			name:    "err: ambiguous group",
+			query:   NameWithGVK{GVK: GVK{Kind: "Deployment"}, NamespacedName: NamespacedName{Namespace: "default", Name: "bar"}},
+			wantErr: []string{"apps/v1 Deployment:default/bar", "example.com/v1 Deployment:default/bar"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loader.GetResource(tt.query)
+			if len(tt.wantErr) > 0 {
+				if err == nil {
+					t.Fatalf("GetResource() error = nil, want error")
+				}
+				for _, want := range tt.wantErr {
+					if !strings.Contains(err.Error(), want) {
+						t.Errorf("GetResource() error = %v, want to contain %q", err, want)
+					}
+				}
+				return
+			}
+			mustNil(t, err)
+			if tt.wantNil {
+				if got != nil {
+					t.Errorf("GetResource() = %v, want nil", got)
+				}
+				return
+			}
+			if got == nil || got.GetNamespace() != tt.wantNamespace || got.GetAPIVersion() != tt.wantAPIVersion {
+				t.Errorf("GetResource() = %v, want %s in %q", got, tt.wantAPIVersion, tt.wantNamespace)
+			}
+		})
+	}
+}
+
+func TestResourceLoader_LoadResources(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		path    string
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "ok: yaml documents",
+			path: "documents.yaml",
+			want: []string{"ConfigMap:a", "ConfigMap:foo/b"},
+		},
+		{
+			name: "ok: lists",
+			path: "list.yaml",
+			want: []string{"Deployment:foo/a", "Deployment:foo/b", "Namespace:foo"},
+		},
+		{
+			name: "ok: object with items is not a list",
+			path: "items.yaml",
+			want: []string{"Inventory:a"},
+		},
+		{
+			name: "ok: json object, stream and array",
+			path: "json",
+			want: []string{"ConfigMap:a", "ConfigMap:b", "ConfigMap:c", "ConfigMap:d"},
+		},
+		{
+			name:    "err: no kind",
+			path:    "invalid-no-kind.yaml",
+			wantErr: "(document 1): object \"a\" has no kind",
+		},
+		{
+			name:    "err: no name in list",
+			path:    "invalid-no-name-in-list.yaml",
+			wantErr: "(document 1): ConfigMap has no metadata.name",
+		},
+		{
+			name:    "err: not an object",
+			path:    "invalid-not-object.json",
+			wantErr: "item 0 is not an object",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			loader := NewResourceLoader()
+			mustNil(t, loader.LoadResources([]string{filepath.Join("testdata/load-resources.test", tt.path)}))
+			err := loader.Err(false)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("LoadResources() error = %v, want to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			mustNil(t, err)
+			var got []string
+			for k := range loader.Resources {
+				got = append(got, k.String())
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadResources() loaded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResourceLoader_SortedResourceKeys(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	loader.AddResource(newUnstructured("example.com/v1", "Deployment", "default", "a"))
+	loader.AddResource(newUnstructured("apps/v1beta2", "Deployment", "default", "a"))
+	loader.AddResource(newUnstructured("apps/v1", "Deployment", "other", "a"))
+	loader.AddResource(newUnstructured("apps/v1", "Deployment", "default", "b"))
+	loader.AddResource(newUnstructured("apps/v1", "Deployment", "default", "a"))
+	var got []string
+	for _, k := range loader.sortedResourceKeys() {
+		got = append(got, schema.GroupVersion{Group: k.Group, Version: k.Version}.String()+" "+k.String())
+	}
+	want := []string{
+		"apps/v1 Deployment:default/a",
+		"apps/v1 Deployment:default/b",
+		"apps/v1 Deployment:other/a",
+		"apps/v1beta2 Deployment:default/a",
+		"example.com/v1 Deployment:default/a",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sortedResourceKeys() = %v, want %v", got, want)
+	}
+}
+
+func TestResourceLoader_Issues(t *testing.T) {
+	t.Parallel()
+	dir := "testdata/load-issues.test"
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	loader := NewResourceLoader()
+	mustNil(t, loader.LoadVaps([]string{path("policy.yaml")}))
+	mustNil(t, loader.LoadResources([]string{path("a.yaml"), path("b.yaml")}))
+	var got []string
+	for _, i := range loader.Issues {
+		s := string(i.Severity) + ": " + strings.TrimPrefix(i.String(), dir+"/")
+		// The message of a decode error depends on the decoder.
+		if i.Severity == LoadIssueError {
+			s, _, _ = strings.Cut(s, ": json")
+			s, _, _ = strings.Cut(s, ": error unmarshaling")
+		}
+		got = append(got, s)
+	}
+	want := []string{
+		`error: policy.yaml (document 2): decode ValidatingAdmissionPolicy`,
+		`warning: policy.yaml (document 3): ValidatingAdmissionPolicy "p" is already defined in ` + path("policy.yaml") + ` (document 1) and is overridden`,
+		`warning: b.yaml (document 2): v1 ConfigMap:a is already defined in ` + path("a.yaml") + ` (document 1) and is overridden`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Issues = %q, want %q", got, want)
+	}
+	if err := loader.Err(false); err == nil || strings.Contains(err.Error(), "warning") {
+		t.Errorf("Err(false) = %v, want the error only", err)
+	}
+	if err := loader.Err(true); err == nil || !strings.Contains(err.Error(), "2 warning(s) are treated as errors") {
+		t.Errorf("Err(true) = %v, want the warnings as errors", err)
+	}
+}
+
+func TestResourceLoader_LoadVaps_Versions(t *testing.T) {
+	t.Parallel()
+	dir := "testdata/load-versions.test"
+	policies := filepath.Join(dir, "policies.yaml")
+	bindings := filepath.Join(dir, "bindings.yaml")
+
+	loader := NewResourceLoader()
+	mustNil(t, loader.LoadVaps([]string{policies}))
+	mustNil(t, loader.LoadResources([]string{bindings}))
+
+	var names []string
+	for name, vap := range loader.Vaps {
+		names = append(names, name)
+		if vap.APIVersion != "admissionregistration.k8s.io/v1" {
+			t.Errorf("Vaps[%q].APIVersion = %q, want v1", name, vap.APIVersion)
+		}
+		if len(vap.Spec.Validations) != 1 {
+			t.Errorf("Vaps[%q].Spec.Validations = %v, want 1 validation", name, vap.Spec.Validations)
+		}
+	}
+	sort.Strings(names)
+	if want := []string{"alpha", "beta"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Vaps = %v, want %v", names, want)
+	}
+	if pk := loader.Vaps["beta"].Spec.ParamKind; pk == nil || pk.Kind != "ConfigMap" {
+		t.Errorf("Vaps[beta].Spec.ParamKind = %v, want ConfigMap", pk)
+	}
+
+	var issues []string
+	for _, i := range loader.Issues {
+		issues = append(issues, string(i.Severity)+": "+strings.TrimPrefix(i.String(), dir+"/"))
+	}
+	wantIssues := []string{
+		`warning: policies.yaml (document 1): field "spec.validations[0].unknownField" is not available in admissionregistration.k8s.io/v1alpha1 and is ignored`,
+		`error: policies.yaml (document 3): unsupported apiVersion "admissionregistration.k8s.io/v2" of ValidatingAdmissionPolicy: ` +
+			`must be one of [admissionregistration.k8s.io/v1 admissionregistration.k8s.io/v1beta1 admissionregistration.k8s.io/v1alpha1]`,
+		`warning: bindings.yaml (document 1): field "spec.unknownField" is not available in admissionregistration.k8s.io/v1alpha1 and is ignored`,
+	}
+	if !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("Issues = %q, want %q", issues, wantIssues)
+	}
+
+	targets, err := newPolicyTargets(loader)
+	mustNil(t, err)
+	if len(targets) != 2 || targets[1].binding == nil {
+		t.Fatalf("newPolicyTargets() = %v, want the binding of beta", targets)
+	}
+	b := targets[1].binding
+	if b.Spec.PolicyName != "beta" || b.Spec.ParamRef == nil || b.Spec.ParamRef.Name != "params" ||
+		b.Spec.ParamRef.ParameterNotFoundAction == nil || *b.Spec.ParamRef.ParameterNotFoundAction != v1.DenyAction {
+		t.Errorf("binding = %+v, want converted from v1alpha1", b.Spec)
+	}
+}
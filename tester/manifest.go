@@ -64,19 +64,29 @@ type TestCase struct {
 	Param     NamespacedName       `yaml:"param,omitempty"`
 	Expect    PolicyDecisionExpect `yaml:"expect,omitempty"`
 	UserInfo  UserInfo             `yaml:"userInfo,omitempty"`
+	// AdmissionReview is the path to an admission.k8s.io/v1 AdmissionReview whose request is evaluated
+	// instead of object, oldObject and userInfo. It is relative to the manifest.
+	AdmissionReview string `yaml:"admissionReview,omitempty"`
+	// RequestKind is the kind of the request when it differs from the version of the objects, e.g. apps/v1beta2.
+	// The objects are converted to the version matched by the policy under spec.matchPolicy.
+	// The group and the kind default to the ones of the object.
+	RequestKind GVK `yaml:"requestKind,omitempty"`
+	// Snapshot compares the whole results with the snapshot file next to the manifest.
+	// Expect can be omitted when it is set.
+	Snapshot bool `yaml:"snapshot,omitempty"`
 	// TODO: Support message test
 	// Message   string                              `yaml:"message"`
 }
 
 type GVK struct {
-	Group   string `yaml:"group,omitempty"`
-	Version string `yaml:"version,omitempty"`
-	Kind    string `yaml:"kind"`
+	Group   string `yaml:"group,omitempty" json:"group,omitempty"`
+	Version string `yaml:"version,omitempty" json:"version,omitempty"`
+	Kind    string `yaml:"kind" json:"kind"`
 }
 
 type NamespacedName struct {
-	Namespace string `yaml:"namespace,omitempty"`
-	Name      string `yaml:"name"`
+	Namespace string `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Name      string `yaml:"name" json:"name"`
 }
 
 func (n NamespacedName) IsValid() bool {
@@ -0,0 +1,90 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestRunner_NamespaceObject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		strict  bool
+		results []Result
+	}{
+		{
+			name:    "ok: a missing namespace is synthesized",
+			results: []Result{ResultAdmit, ResultAdmit, ResultAdmit, ResultDeny, ResultDeny},
+		},
+		{
+			name:    "ok: a missing namespace is a setup error in the strict mode",
+			strict:  true,
+			results: []Result{ResultAdmit, ResultAdmit, ResultAdmit, ResultDeny, ResultSetupError},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			report, err := NewRunner(Options{StrictNamespaces: tt.strict}).Run([]string{"testdata/vap-with-namespace-object.test/kaptest.yaml"})
+			mustNil(t, err)
+			cases := report.Manifests[0].Suites[0].Cases
+			if len(cases) != len(tt.results) {
+				t.Fatalf("got %d cases, want %d", len(cases), len(tt.results))
+			}
+			for i, c := range cases {
+				if c.Result != tt.results[i] {
+					t.Errorf("case %d: got %s (%v), want %s", i, c.Result, c.Errors, tt.results[i])
+				}
+			}
+			if c := cases[len(cases)-1]; tt.strict && (len(c.Errors) == 0 || !strings.Contains(c.Errors[0], `namespace "missing" not found`)) {
+				t.Errorf("errors = %v, want the missing namespace", c.Errors)
+			}
+		})
+	}
+}
+
+func TestRequestNamespace(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	loader.crds[schema.GroupKind{Group: "example.com", Kind: "Widget"}] = &customResourceDefinition{namespaced: true}
+	loader.crds[schema.GroupKind{Group: "example.com", Kind: "Gadget"}] = &customResourceDefinition{namespaced: false}
+	tests := []struct {
+		name  string
+		group string
+		kind  string
+		want  string
+	}{
+		{name: "ok: namespaced built-in", kind: "Pod", want: "ns"},
+		{name: "ok: cluster-scoped built-in", group: "rbac.authorization.k8s.io", kind: "ClusterRole"},
+		{name: "ok: namespace itself", kind: "Namespace"},
+		{name: "ok: namespaced custom resource", group: "example.com", kind: "Widget", want: "ns"},
+		{name: "ok: cluster-scoped custom resource", group: "example.com", kind: "Gadget"},
+		{name: "ok: unknown kind", group: "example.com", kind: "Unknown", want: "ns"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := requestNamespace(loader, schema.GroupKind{Group: tt.group, Kind: tt.kind}, "ns"); got != tt.want {
+				t.Errorf("requestNamespace() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// OutputFormat is the format of the test results.
+type OutputFormat string
+
+const (
+	// OutputText is the human-readable format.
+	OutputText OutputFormat = "text"
+	// OutputJSON is the JSON representation of Report.
+	OutputJSON OutputFormat = "json"
+	// OutputJUnit is the JUnit XML format.
+	OutputJUnit OutputFormat = "junit"
+	// OutputTAP is the Test Anything Protocol version 13.
+	OutputTAP OutputFormat = "tap"
+	// OutputGitHub is the workflow commands of GitHub Actions to annotate the failures on the source files.
+	OutputGitHub OutputFormat = "github"
+	// OutputSARIF is the SARIF 2.1.0 format to annotate the failures on the source files.
+	OutputSARIF OutputFormat = "sarif"
+)
+
+// OutputFormats is the list of supported output formats.
+var OutputFormats = []OutputFormat{OutputText, OutputJSON, OutputJUnit, OutputTAP, OutputGitHub, OutputSARIF}
+
+// stdoutPath is the path to write the results to stdout.
+const stdoutPath = "-"
+
+// output is a destination of the test results.
+type output struct {
+	format OutputFormat
+	path   string
+	w      io.Writer
+}
+
+type outputs []output
+
+// openOutputs opens the destinations of the test results.
+// Each spec is in the form of "format" or "format=path". The results are written to stdout
+// when the path is omitted or "-". The text format is used when no spec is given.
+func openOutputs(specs []string) (outputs, error) {
+	if len(specs) == 0 {
+		specs = []string{string(OutputText)}
+	}
+	var outs outputs
+	toStdout := 0
+	for _, spec := range specs {
+		format, path, _ := strings.Cut(spec, "=")
+		o := output{format: OutputFormat(format), path: path}
+		if !o.format.isValid() {
+			outs.close()
+			return nil, fmt.Errorf("unknown output format %q", format)
+		}
+		if path == "" || path == stdoutPath {
+			toStdout++
+			o.path = stdoutPath
+			o.w = os.Stdout
+		} else {
+			f, err := os.Create(path)
+			if err != nil {
+				outs.close()
+				return nil, fmt.Errorf("create output file: %w", err)
+			}
+			o.w = f
+		}
+		outs = append(outs, o)
+	}
+	if toStdout > 1 {
+		outs.close()
+		return nil, errors.New("only one output can be written to stdout")
+	}
+	return outs, nil
+}
+
+func (f OutputFormat) isValid() bool {
+	for _, v := range OutputFormats {
+		if f == v {
+			return true
+		}
+	}
+	return false
+}
+
+func (outs outputs) close() {
+	for _, o := range outs {
+		if c, ok := o.w.(io.Closer); ok && o.path != stdoutPath {
+			if err := c.Close(); err != nil {
+				slog.Error("close output file", "path", o.path, "error", err)
+			}
+		}
+	}
+}
+
+// messageWriter returns the writer of the messages for users other than the results.
+// It is stdout unless the results in a machine-readable format are written there.
+func (outs outputs) messageWriter() io.Writer {
+	for _, o := range outs {
+		if o.path == stdoutPath && o.format != OutputText {
+			return os.Stderr
+		}
+	}
+	return os.Stdout
+}
+
+// writeManifest writes the results of a manifest as soon as it finishes.
+// Only the text format is written progressively.
+func (outs outputs) writeManifest(m ManifestReport, verbose bool) {
+	for _, o := range outs {
+		if o.format == OutputText {
+			writeManifestText(o.w, m, verbose)
+		}
+	}
+}
+
+// writeReport writes the whole test results.
+func (outs outputs) writeReport(r Report) error {
+	for _, o := range outs {
+		var err error
+		switch o.format {
+		case OutputText:
+			err = writeTextFooter(o.w, r)
+		case OutputJSON:
+			err = writeJSON(o.w, r)
+		case OutputJUnit:
+			err = writeJUnit(o.w, r)
+		case OutputTAP:
+			err = writeTAP(o.w, r)
+		case OutputGitHub:
+			err = writeGitHubActions(o.w, r)
+		case OutputSARIF:
+			err = writeSARIF(o.w, r)
+		}
+		if err != nil {
+			return fmt.Errorf("write %s output: %w", o.format, err)
+		}
+	}
+	return nil
+}
+
+// writeManifestText writes the results of a manifest in the human-readable format.
+// The details of passed test cases are written only when verbose is true.
+func writeManifestText(w io.Writer, m ManifestReport, verbose bool) {
+	out := []string{fmt.Sprintf("[%s]", m.Path)}
+	if m.Error != "" {
+		out = append(out, fmt.Sprintf("FAIL: %s", m.Error))
+	}
+	for _, i := range m.LoadIssues {
+		if i.Severity == LoadIssueWarning {
+			out = append(out, "WARNING: "+i.String())
+		}
+	}
+	for _, s := range m.Suites {
+		if s.Error != "" {
+			out = append(out, fmt.Sprintf("FAIL: %s ==> %s", s.Policy, strings.ToUpper(s.Error)))
+			continue
+		}
+		for _, c := range s.Cases {
+			out = append(out, summaryLine(c.Pass, s.Policy, c))
+			if c.Pass && !verbose && c.Result != ResultSetupError && c.Result != ResultFatalError {
+				continue
+			}
+			for _, l := range caseDetailLines(c) {
+				out = append(out, "--- "+l)
+			}
+		}
+	}
+	out = append(out, fmt.Sprintf("Total: %d, Pass: %d, Fail: %d\n", m.Total, m.Pass, m.Fail))
+	fmt.Fprintln(w, strings.Join(out, "\n"))
+}
+
+// writeTextFooter writes the total of the results and the untested policies.
+// The results of each manifest are written by writeManifest.
+func writeTextFooter(w io.Writer, r Report) error {
+	var b strings.Builder
+	if len(r.Manifests) > 1 {
+		b.WriteString("--------------------------------------------------\n")
+		fmt.Fprintf(&b, "Total: %d, Pass: %d, Fail: %d\n", r.Total, r.Pass, r.Fail)
+	}
+	if len(r.UntestedPolicies) > 0 {
+		b.WriteString("--------------------------------------------------\n")
+		fmt.Fprintf(&b, "Policies without tests: %d\n", len(r.UntestedPolicies))
+		for _, p := range r.UntestedPolicies {
+			fmt.Fprintf(&b, "- %s (%s)\n", p.Name, p.Path)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeJSON(w io.Writer, r Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Errors   int             `xml:"errors,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+// writeJUnit writes the results in JUnit XML format.
+// A test suite is generated for each pair of a manifest and a policy.
+// Errors which prevent running the test cases are reported as a test case with an error.
+func writeJUnit(w io.Writer, r Report) error {
+	root := junitTestSuites{
+		Name:  "kaptest",
+		Tests: r.Total,
+		Time:  junitTime(r.Duration),
+	}
+	for _, m := range r.Manifests {
+		if m.Error != "" {
+			root.Suites = append(root.Suites, junitErrorSuite(m.Path, m.Path, m.Error, m.Duration))
+			continue
+		}
+		for _, s := range m.Suites {
+			name := m.Path + ":" + s.Policy
+			if s.Error != "" {
+				root.Suites = append(root.Suites, junitErrorSuite(name, s.Policy, s.Error, 0))
+				continue
+			}
+			suite := junitTestSuite{Name: name, Tests: len(s.Cases)}
+			var duration float64
+			for _, c := range s.Cases {
+				tc := junitTestCase{
+					Name:      c.Name,
+					ClassName: name,
+					Time:      junitTime(c.Duration),
+				}
+				if !c.Pass {
+					msg := &junitMessage{
+						Message: fmt.Sprintf("expected %s but got %s", strings.ToUpper(string(c.Expect)), resultLabel(c.Result)),
+						Type:    string(c.Result),
+						Body:    caseDetails(c),
+					}
+					if (c.Expect == "" || Result(c.Expect) == c.Result) && c.SnapshotMismatch != "" {
+						msg.Message = "results do not match the snapshot"
+					}
+					if c.Result == ResultSetupError || c.Result == ResultFatalError {
+						tc.Error = msg
+						suite.Errors++
+					} else {
+						tc.Failure = msg
+						suite.Failures++
+					}
+				}
+				duration += c.Duration
+				suite.Cases = append(suite.Cases, tc)
+			}
+			suite.Time = junitTime(duration)
+			root.Suites = append(root.Suites, suite)
+		}
+	}
+	for _, s := range root.Suites {
+		root.Failures += s.Failures
+		root.Errors += s.Errors
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(root); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitErrorSuite(name, caseName, message string, duration float64) junitTestSuite {
+	return junitTestSuite{
+		Name:   name,
+		Tests:  1,
+		Errors: 1,
+		Time:   junitTime(duration),
+		Cases: []junitTestCase{
+			{
+				Name:      caseName,
+				ClassName: name,
+				Time:      junitTime(duration),
+				Error:     &junitMessage{Message: message, Type: "error"},
+			},
+		},
+	}
+}
+
+func junitTime(seconds float64) string {
+	return fmt.Sprintf("%.3f", seconds)
+}
+
+// caseDetails returns the decisions and errors of the test case in multiple lines.
+func caseDetails(c CaseReport) string {
+	return strings.Join(caseDetailLines(c), "\n")
+}
+
+// caseDetailLines returns the decisions, the failed matchCondition and the errors of the test case.
+func caseDetailLines(c CaseReport) []string {
+	var lines []string
+	for _, d := range c.Decisions {
+		if d.Evaluation == ResultAdmit {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s: reason %q, message %q", resultLabel(d.Evaluation), d.Reason, d.Message))
+	}
+	if c.Result == ResultSkip {
+		lines = append(lines, fmt.Sprintf("NOT MATCH: condition-name %q", c.FailedMatchCondition))
+	}
+	for _, e := range c.Errors {
+		lines = append(lines, "ERROR: "+e)
+	}
+	if c.SnapshotMismatch != "" {
+		for i, l := range strings.Split(c.SnapshotMismatch, "\n") {
+			if i == 0 {
+				lines = append(lines, "SNAPSHOT: "+l)
+			} else {
+				lines = append(lines, "    "+l)
+			}
+		}
+	}
+	return lines
+}
+
+// writeTAP writes the results in TAP version 13.
+// Errors which prevent running the test cases are reported as a failed test point.
+func writeTAP(w io.Writer, r Report) error {
+	var b strings.Builder
+	b.WriteString("TAP version 13\n")
+	n := 0
+	point := func(ok bool, description, details string) {
+		n++
+		status := "ok"
+		if !ok {
+			status = "not ok"
+		}
+		fmt.Fprintf(&b, "%s %d - %s\n", status, n, description)
+		if details == "" {
+			return
+		}
+		b.WriteString("  ---\n  message: |\n")
+		for _, l := range strings.Split(details, "\n") {
+			fmt.Fprintf(&b, "    %s\n", l)
+		}
+		b.WriteString("  ...\n")
+	}
+	for _, m := range r.Manifests {
+		if m.Error != "" {
+			point(false, m.Path, m.Error)
+			continue
+		}
+		for _, s := range m.Suites {
+			if s.Error != "" {
+				point(false, fmt.Sprintf("%s: %s", m.Path, s.Policy), s.Error)
+				continue
+			}
+			for _, c := range s.Cases {
+				description := fmt.Sprintf("%s: %s - %s - %s ==> %s", m.Path, s.Policy, c.Name, strings.ToUpper(string(c.Expect)), resultLabel(c.Result))
+				details := ""
+				if !c.Pass {
+					details = caseDetails(c)
+				}
+				point(c.Pass, description, details)
+			}
+		}
+	}
+	fmt.Fprintf(&b, "1..%d\n", n)
+	for _, p := range r.UntestedPolicies {
+		fmt.Fprintf(&b, "# policy without tests: %s (%s)\n", p.Name, p.Path)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenOutputs(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		specs   []string
+		wantErr bool
+	}{
+		{name: "ok: default", specs: nil},
+		{name: "ok: stdout", specs: []string{"json"}},
+		{name: "ok: multiple outputs", specs: []string{"text", "junit=" + filepath.Join(dir, "junit.xml"), "tap=" + filepath.Join(dir, "out.tap")}},
+		{name: "err: unknown format", specs: []string{"yaml"}, wantErr: true},
+		{name: "err: multiple outputs to stdout", specs: []string{"text", "json=-"}, wantErr: true},
+		{name: "err: cannot create file", specs: []string{"json=" + filepath.Join(dir, "not-found", "out.json")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outs, err := openOutputs(tt.specs)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("openOutputs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			outs.close()
+		})
+	}
+}
+
+func TestRun_Outputs(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "out.json")
+	junitPath := filepath.Join(dir, "junit.xml")
+	tapPath := filepath.Join(dir, "out.tap")
+	cfg := CmdConfig{Outputs: []string{"json=" + jsonPath, "junit=" + junitPath, "tap=" + tapPath}}
+	err := Run(cfg, []string{
+		"./testdata/vap-standard-resources.test/kaptest.yaml",
+		"./testdata/vap-standard-resources.test/invalid-no-policy.yaml",
+		"./testdata/invalid-format.yaml",
+	})
+	if err != ErrTestFail {
+		t.Fatalf("Run() = %v, want %v", err, ErrTestFail)
+	}
+
+	buf, err := os.ReadFile(jsonPath)
+	mustNil(t, err)
+	var report Report
+	mustNil(t, json.Unmarshal(buf, &report))
+	if report.SchemaVersion != ReportSchemaVersion || len(report.Manifests) != 3 {
+		t.Fatalf("unexpected report: %s", buf)
+	}
+	if report.Total != 14 || report.Pass != 12 || report.Fail != 2 {
+		t.Errorf("unexpected summary: total %d, pass %d, fail %d", report.Total, report.Pass, report.Fail)
+	}
+	if got := report.Manifests[0].Suites[0].Cases[1]; got.Result != ResultDeny || !got.Pass || len(got.Decisions) != 1 {
+		t.Errorf("unexpected case report: %+v", got)
+	}
+	if got := report.Manifests[1].Suites[0]; got.Error == "" {
+		t.Errorf("policy not found is not reported: %+v", got)
+	}
+	if got := report.Manifests[2]; got.Error == "" {
+		t.Errorf("manifest error is not reported: %+v", got)
+	}
+
+	buf, err = os.ReadFile(junitPath)
+	mustNil(t, err)
+	var suites junitTestSuites
+	mustNil(t, xml.Unmarshal(buf, &suites))
+	if suites.Tests != 14 || suites.Failures != 0 || suites.Errors != 2 {
+		t.Errorf("unexpected junit output: %s", buf)
+	}
+
+	buf, err = os.ReadFile(tapPath)
+	mustNil(t, err)
+	if !bytes.HasPrefix(buf, []byte("TAP version 13\n")) || !bytes.Contains(buf, []byte("\n1..14\n")) || bytes.Count(buf, []byte("\nnot ok ")) != 2 {
+		t.Errorf("unexpected tap output: %s", buf)
+	}
+}
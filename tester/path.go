@@ -0,0 +1,204 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// manifestFileExts is the list of file extensions to be loaded when a directory is given.
+var manifestFileExts = []string{".yaml", ".yml", ".json"}
+
+// resolvePaths returns the paths relative to baseDir. Absolute paths are returned as they are.
+func resolvePaths(baseDir string, paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		if filepath.IsAbs(p) {
+			out[i] = p
+		} else {
+			out[i] = filepath.Join(baseDir, p)
+		}
+	}
+	return out
+}
+
+// expandPaths expands the given paths into a list of files.
+// Each entry can be a file, a directory or a glob pattern.
+//
+//   - A directory is expanded to the YAML and JSON files directly under it.
+//   - A glob pattern supports the syntax of filepath.Match and "**" matching zero or more directories.
+//
+// Files matched by a single entry are sorted lexically, and entries are expanded in the given order.
+// A file matched by several entries appears only once at its first position.
+// It returns an error if an entry matches no file.
+func expandPaths(paths []string) ([]string, error) {
+	var files []string
+	seen := map[string]struct{}{}
+	for _, p := range paths {
+		matched, err := expandPath(p)
+		if err != nil {
+			return nil, err
+		}
+		if len(matched) == 0 {
+			return nil, fmt.Errorf("no file matches %q", p)
+		}
+		for _, m := range matched {
+			if _, ok := seen[m]; ok {
+				continue
+			}
+			seen[m] = struct{}{}
+			files = append(files, m)
+		}
+	}
+	return files, nil
+}
+
+func expandPath(p string) ([]string, error) {
+	if !hasMeta(p) {
+		info, err := os.Stat(p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("stat %q: %w", p, err)
+		}
+		if info.IsDir() {
+			return listManifestFiles(p)
+		}
+		return []string{p}, nil
+	}
+
+	pattern := filepath.Clean(p)
+	if _, err := filepath.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+	}
+	root := globRoot(pattern)
+	var matched []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == root {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if matchPattern(splitPath(pattern), splitPath(path)) {
+			matched = append(matched, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walk %q: %w", root, err)
+	}
+	sort.Strings(matched)
+	return matched, nil
+}
+
+// listManifestFiles returns the YAML and JSON files directly under the directory in lexical order.
+func listManifestFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %q: %w", dir, err)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || !hasManifestExt(e.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, e.Name()))
+	}
+	return files, nil
+}
+
+func hasManifestExt(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range manifestFileExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func hasMeta(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+// globRoot returns the longest leading directory of the pattern which contains no meta characters.
+func globRoot(pattern string) string {
+	segments := splitPath(pattern)
+	var static []string
+	for _, s := range segments[:len(segments)-1] {
+		if hasMeta(s) {
+			break
+		}
+		static = append(static, s)
+	}
+	if len(static) == 0 {
+		if filepath.IsAbs(pattern) {
+			return string(filepath.Separator)
+		}
+		return "."
+	}
+	root := filepath.Join(static...)
+	if filepath.IsAbs(pattern) {
+		root = string(filepath.Separator) + root
+	}
+	return root
+}
+
+func splitPath(p string) []string {
+	var segments []string
+	for _, s := range strings.Split(filepath.ToSlash(filepath.Clean(p)), "/") {
+		if s == "" || s == "." {
+			continue
+		}
+		segments = append(segments, s)
+	}
+	return segments
+}
+
+// matchPattern reports whether the path segments match the pattern segments.
+// "**" matches zero or more segments, other segments are matched by filepath.Match.
+func matchPattern(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(path); i++ {
+			if matchPattern(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(path) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], path[0]); !ok {
+		return false
+	}
+	return matchPattern(pattern[1:], path[1:])
+}
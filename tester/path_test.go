@@ -0,0 +1,107 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandPaths(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	for _, f := range []string{
+		"policies/b.yaml",
+		"policies/a.yaml",
+		"policies/readme.md",
+		"fixtures/deploy.yaml",
+		"fixtures/apps/v1/deploy.yaml",
+		"fixtures/core/pod.yml",
+	} {
+		p := filepath.Join(dir, f)
+		mustNil(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		mustNil(t, os.WriteFile(p, []byte{}, 0o644)) //nolint:gosec
+	}
+	join := func(paths ...string) []string {
+		out := make([]string, len(paths))
+		for i, p := range paths {
+			out[i] = filepath.Join(dir, p)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		paths   []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:  "ok: file",
+			paths: join("policies/b.yaml"),
+			want:  join("policies/b.yaml"),
+		},
+		{
+			name:  "ok: directory",
+			paths: join("policies"),
+			want:  join("policies/a.yaml", "policies/b.yaml"),
+		},
+		{
+			name:  "ok: glob",
+			paths: join("policies/*.yaml"),
+			want:  join("policies/a.yaml", "policies/b.yaml"),
+		},
+		{
+			name:  "ok: double star glob",
+			paths: join("fixtures/**/*.yaml"),
+			want:  join("fixtures/apps/v1/deploy.yaml", "fixtures/deploy.yaml"),
+		},
+		{
+			name:  "ok: keep the order of entries and remove duplicates",
+			paths: join("policies/b.yaml", "policies/*.yaml"),
+			want:  join("policies/b.yaml", "policies/a.yaml"),
+		},
+		{
+			name:    "err: file not found",
+			paths:   join("policies/not-found.yaml"),
+			wantErr: true,
+		},
+		{
+			name:    "err: pattern matches nothing",
+			paths:   join("policies/*.json"),
+			wantErr: true,
+		},
+		{
+			name:    "err: invalid pattern",
+			paths:   join("policies/[.yaml"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandPaths(tt.paths)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expandPaths() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandPaths() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Position is a location in a source file.
+type Position struct {
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column,omitempty"`
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+func newPosition(file string, n *yamlv3.Node) *Position {
+	return &Position{File: file, Line: n.Line, Column: n.Column}
+}
+
+// manifestPositions is the positions of the entries in a test manifest.
+type manifestPositions struct {
+	// suites is the positions of testSuites[i].
+	suites []*Position
+	// cases is the positions of testSuites[i].tests[j].
+	cases [][]*Position
+}
+
+// parseManifestPositions returns the positions of the test suites and test cases in the manifest.
+// The positions are best-effort and nil is returned for entries which cannot be located.
+func parseManifestPositions(file string, buf []byte) manifestPositions {
+	var out manifestPositions
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(buf, &doc); err != nil || len(doc.Content) == 0 {
+		return out
+	}
+	suites := mappingValue(doc.Content[0], "testSuites")
+	if suites == nil || suites.Kind != yamlv3.SequenceNode {
+		return out
+	}
+	for _, s := range suites.Content {
+		out.suites = append(out.suites, newPosition(file, s))
+		var cases []*Position
+		if tests := mappingValue(s, "tests"); tests != nil && tests.Kind == yamlv3.SequenceNode {
+			for _, c := range tests.Content {
+				cases = append(cases, newPosition(file, c))
+			}
+		}
+		out.cases = append(out.cases, cases)
+	}
+	return out
+}
+
+func (m manifestPositions) suite(i int) *Position {
+	if i < len(m.suites) {
+		return m.suites[i]
+	}
+	return nil
+}
+
+func (m manifestPositions) testCase(i, j int) *Position {
+	if i < len(m.cases) && j < len(m.cases[i]) {
+		return m.cases[i][j]
+	}
+	return nil
+}
+
+// policyPositions is the positions of a ValidatingAdmissionPolicy and its CEL expressions.
+type policyPositions struct {
+	policy      *Position
+	expressions []expressionPosition
+}
+
+// expressionPosition is the position of a CEL expression in a policy.
+type expressionPosition struct {
+	// field is the path to the expression, e.g. "spec.validations[0].expression".
+	field      string
+	expression string
+	position   *Position
+}
+
+// expressionFields is the list of fields which have CEL expressions in ValidatingAdmissionPolicy.
+var expressionFields = []struct {
+	list string
+	keys []string
+}{
+	{list: "matchConditions", keys: []string{"expression"}},
+	{list: "variables", keys: []string{"expression"}},
+	{list: "validations", keys: []string{"expression", "messageExpression"}},
+	{list: "auditAnnotations", keys: []string{"valueExpression"}},
+}
+
+// parsePolicyPositions returns the positions of ValidatingAdmissionPolicies in the YAML file keyed by name.
+// The positions are best-effort and the documents which cannot be parsed are skipped.
+func parsePolicyPositions(file string, buf []byte) map[string]*policyPositions {
+	out := map[string]*policyPositions{}
+	decoder := yamlv3.NewDecoder(bytes.NewReader(buf))
+	for {
+		var doc yamlv3.Node
+		if err := decoder.Decode(&doc); err != nil {
+			if !errors.Is(err, io.EOF) {
+				return out
+			}
+			break
+		}
+		if len(doc.Content) == 0 {
+			continue
+		}
+		root := doc.Content[0]
+		if kind := mappingValue(root, "kind"); kind == nil || kind.Value != "ValidatingAdmissionPolicy" {
+			continue
+		}
+		name := mappingValue(mappingValue(root, "metadata"), "name")
+		if name == nil {
+			continue
+		}
+		p := &policyPositions{policy: newPosition(file, root)}
+		spec := mappingValue(root, "spec")
+		for _, f := range expressionFields {
+			list := mappingValue(spec, f.list)
+			if list == nil || list.Kind != yamlv3.SequenceNode {
+				continue
+			}
+			for i, item := range list.Content {
+				for _, key := range f.keys {
+					if v := mappingValue(item, key); v != nil {
+						p.expressions = append(p.expressions, expressionPosition{
+							field:      fmt.Sprintf("spec.%s[%d].%s", f.list, i, key),
+							expression: v.Value,
+							position:   newPosition(file, v),
+						})
+					}
+				}
+			}
+		}
+		out[name.Value] = p
+	}
+	return out
+}
+
+func (p *policyPositions) field(field string) *expressionPosition {
+	for i := range p.expressions {
+		if p.expressions[i].field == field {
+			return &p.expressions[i]
+		}
+	}
+	return nil
+}
+
+// compileErrorLine matches the location of a CEL compile error, e.g. "ERROR: <input>:1:5: ...".
+var compileErrorLine = regexp.MustCompile(`<input>:(\d+):\d+:`)
+
+// locate returns the position of the expression which the error or deny message is about.
+// Messages of evaluation errors contain the expression, and those of compile errors contain
+// the source line of the expression. The expression of the field fallback is used if no expression is found.
+func (p *policyPositions) locate(message, fallback string) *Position {
+	if p == nil {
+		return nil
+	}
+	fb := p.field(fallback)
+	if fb != nil && strings.TrimSpace(fb.expression) != "" && strings.Contains(message, strings.TrimSpace(fb.expression)) {
+		return fb.position
+	}
+	for _, e := range p.expressions {
+		if e.expression != "" && strings.Contains(message, "'"+e.expression+"'") {
+			return e.position
+		}
+	}
+	if m := compileErrorLine.FindStringSubmatch(message); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		for _, e := range p.expressions {
+			lines := strings.Split(e.expression, "\n")
+			if line < 1 || line > len(lines) || strings.TrimSpace(lines[line-1]) == "" {
+				continue
+			}
+			if strings.Contains(message, "| "+lines[line-1]) {
+				return e.position
+			}
+		}
+	}
+	if fb != nil {
+		return fb.position
+	}
+	return p.policy
+}
+
+// annotate sets the positions of the expressions related to the result of the test case.
+// A decision falls back to the expression of the validation which made it, or to the policy
+// if it is not made by a single validation.
+func (p *policyPositions) annotate(c *CaseReport) {
+	if p == nil {
+		return
+	}
+	for i := range c.Decisions {
+		d := &c.Decisions[i]
+		if d.Evaluation == ResultAdmit {
+			continue
+		}
+		fallback := ""
+		if d.validation != nil {
+			fallback = fmt.Sprintf("spec.validations[%d].expression", *d.validation)
+		}
+		d.Position = p.locate(d.Message, fallback)
+	}
+	if c.Result == ResultError && len(c.Decisions) == 0 && len(c.Errors) > 0 {
+		c.ExpressionPosition = p.locate(strings.Join(c.Errors, "\n"), "spec.matchConditions[0].expression")
+	}
+}
+
+// mappingValue returns the value of the key in the mapping node, or nil if not found.
+func mappingValue(n *yamlv3.Node, key string) *yamlv3.Node {
+	if n == nil || n.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return n.Content[i+1]
+		}
+	}
+	return nil
+}
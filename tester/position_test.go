@@ -0,0 +1,126 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseManifestPositions(t *testing.T) {
+	t.Parallel()
+	file := "testdata/vap-standard-resources.test/kaptest.yaml"
+	buf, err := os.ReadFile(file)
+	mustNil(t, err)
+	positions := parseManifestPositions(file, buf)
+
+	if got := positions.suite(0); got == nil || got.Line != 6 || got.Column != 3 {
+		t.Errorf("suite(0) = %v, want line 6, column 3", got)
+	}
+	if got := positions.testCase(0, 1); got == nil || got.Line != 12 || got.Column != 5 {
+		t.Errorf("testCase(0, 1) = %v, want line 12, column 5", got)
+	}
+	if got := positions.testCase(0, 100); got != nil {
+		t.Errorf("testCase(0, 100) = %v, want nil", got)
+	}
+	if got := positions.suite(100); got != nil {
+		t.Errorf("suite(100) = %v, want nil", got)
+	}
+}
+
+func TestPolicyPositions_Locate(t *testing.T) {
+	t.Parallel()
+	file := "testdata/vap-standard-resources.yaml"
+	buf, err := os.ReadFile(file)
+	mustNil(t, err)
+	positions := parsePolicyPositions(file, buf)
+	p := positions["deployment-replicas-with-matchCondition"]
+	if p == nil {
+		t.Fatalf("positions of the policy are not found: %v", positions)
+	}
+
+	tests := []struct {
+		name     string
+		message  string
+		fallback string
+		wantLine int
+	}{
+		{
+			name:     "ok: expression of the fallback field in the message",
+			message:  "failed expression: object.spec.replicas <= 5",
+			fallback: "spec.validations[0].expression",
+			wantLine: 59,
+		},
+		{
+			name:     "ok: evaluation error of another expression",
+			message:  `expression 'request.operation == "CREATE" || oldObject.?metadata.?labels['immutable'].orValue("") != "true"' resulted in error: no such key`,
+			fallback: "spec.validations[0].expression",
+			wantLine: 57,
+		},
+		{
+			name:     "ok: compile error",
+			message:  "compilation failed: ERROR: <input>:1:8: undeclared reference\n | request.operation == \"CREATE\" || oldObject.?metadata.?labels['immutable'].orValue(\"\") != \"true\"\n | .......^",
+			fallback: "spec.validations[0].expression",
+			wantLine: 57,
+		},
+		{
+			name:     "ok: fallback field",
+			message:  "unknown message",
+			fallback: "spec.validations[0].expression",
+			wantLine: 59,
+		},
+		{
+			name:     "ok: policy",
+			message:  "unknown message",
+			fallback: "spec.validations[1].expression",
+			wantLine: 43,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.locate(tt.message, tt.fallback)
+			if got == nil || got.File != file || got.Line != tt.wantLine {
+				t.Errorf("locate() = %v, want line %d", got, tt.wantLine)
+			}
+		})
+	}
+}
+
+func TestPolicyPositions_Annotate(t *testing.T) {
+	t.Parallel()
+	file := "testdata/vap-with-admission-review.yaml"
+	buf, err := os.ReadFile(file)
+	mustNil(t, err)
+	p := parsePolicyPositions(file, buf)["deployment-replicas"]
+	if p == nil {
+		t.Fatalf("positions of the policy are not found")
+	}
+
+	validation := 2
+	c := CaseReport{Result: ResultError, Decisions: []DecisionReport{
+		// The decisions of the other validations are skipped.
+		{Evaluation: ResultDeny, Message: "replicas cannot be decreased", validation: &validation},
+		// An error of the whole policy is not located at spec.validations[1].
+		{Evaluation: ResultError, Message: "unknown error"},
+	}}
+	p.annotate(&c)
+	for i, wantLine := range []int{18, 1} {
+		if got := c.Decisions[i].Position; got == nil || got.Line != wantLine {
+			t.Errorf("Decisions[%d].Position = %v, want line %d", i, got, wantLine)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/pfnet/kaptest"
+	"google.golang.org/protobuf/types/known/structpb"
+	"gopkg.in/yaml.v2"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	replPrompt = "kaptest> "
+	replHelp   = `Enter a CEL expression to evaluate it, or one of the commands:
+  :load <manifest>           Load the policies and resources of the test manifest
+  :list                      List the policies, resources and test cases
+  :case <n>                  Use the context of the n-th test case listed by :list
+  :policy <name>|-           Use the variables and paramKind of the policy
+  :use <target> <ref>|-      Use the resource as object, oldObject, params or namespace.
+                             <ref> is "[apiVersion] Kind:[namespace/]name", e.g. "apps/v1 Deployment:default/foo"
+  :user <name> [groups...]|- Use the user who sends the request
+  :context                   Show the current context
+  :history                   Show the evaluated expressions
+  !<n>                       Evaluate the n-th expression in the history again
+  :help                      Show this help
+  :quit                      Exit`
+)
+
+// replCase is a test case in the loaded manifest.
+type replCase struct {
+	policy string
+	tc     TestCase
+}
+
+// repl is an interactive CEL evaluator bound to the resources of a test manifest.
+type repl struct {
+	out      io.Writer
+	manifest string
+	loader   *ResourceLoader
+	cases    []replCase
+
+	policy    string
+	object    NameWithGVK
+	oldObject NameWithGVK
+	params    NameWithGVK
+	namespace NameWithGVK
+	userInfo  UserInfo
+
+	history []string
+}
+
+func newREPL(out io.Writer) *repl {
+	return &repl{out: out, loader: NewResourceLoader()}
+}
+
+// RunREPL starts the interactive CEL REPL on stdin and stdout. The manifest is loaded first if given.
+func RunREPL(manifestPath string) error {
+	r := newREPL(os.Stdout)
+	if manifestPath != "" {
+		if err := r.load(manifestPath); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(r.out, `Type ":help" for the commands.`)
+	return r.run(os.Stdin, true)
+}
+
+// run reads the lines from in until EOF or :quit. The prompt is written before each line if prompt is true.
+func (r *repl) run(in io.Reader, prompt bool) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if prompt {
+			fmt.Fprint(r.out, replPrompt)
+		}
+		if !scanner.Scan() {
+			if prompt {
+				fmt.Fprintln(r.out)
+			}
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == ":quit" || line == ":exit" {
+			return nil
+		}
+		if err := r.exec(line); err != nil {
+			fmt.Fprintf(r.out, "error: %v\n", err)
+		}
+	}
+}
+
+// exec executes a line of the input.
+func (r *repl) exec(line string) error {
+	if line == "" {
+		return nil
+	}
+	if strings.HasPrefix(line, "!") {
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 1 || n > len(r.history) {
+			return fmt.Errorf("no expression %q in the history", line[1:])
+		}
+		line = r.history[n-1]
+		fmt.Fprintln(r.out, line)
+	}
+	if !strings.HasPrefix(line, ":") {
+		r.history = append(r.history, line)
+		r.eval(line)
+		return nil
+	}
+
+	fields := strings.Fields(line)
+	cmd, args := fields[0], fields[1:]
+	switch cmd {
+	case ":help":
+		fmt.Fprintln(r.out, replHelp)
+	case ":load":
+		if len(args) != 1 {
+			return errors.New("usage: :load <manifest>")
+		}
+		return r.load(args[0])
+	case ":list":
+		r.list()
+	case ":case":
+		n, err := strconv.Atoi(strings.Join(args, ""))
+		if err != nil || n < 1 || n > len(r.cases) {
+			return errors.New("usage: :case <n> (see :list)")
+		}
+		r.useCase(r.cases[n-1])
+		r.showContext()
+	case ":policy":
+		if len(args) != 1 {
+			return errors.New("usage: :policy <name>|-")
+		}
+		if args[0] == "-" {
+			r.policy = ""
+		} else if _, ok := r.loader.Vaps[args[0]]; !ok {
+			return fmt.Errorf("policy %q is not loaded", args[0])
+		} else {
+			r.policy = args[0]
+		}
+	case ":use":
+		return r.use(args)
+	case ":user":
+		if len(args) == 0 {
+			return errors.New("usage: :user <name> [groups...]|-")
+		}
+		if args[0] == "-" {
+			r.userInfo = UserInfo{}
+		} else {
+			r.userInfo = UserInfo{Name: args[0], Groups: args[1:]}
+		}
+	case ":context":
+		r.showContext()
+	case ":history":
+		for i, h := range r.history {
+			fmt.Fprintf(r.out, "%4d  %s\n", i+1, h)
+		}
+	default:
+		return fmt.Errorf("unknown command %q; see :help", cmd)
+	}
+	return nil
+}
+
+// load loads the policies and resources of the manifest and resets the context.
+func (r *repl) load(manifestPath string) error {
+	buf, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return fmt.Errorf("read manifest YAML: %w", err)
+	}
+	var manifests TestManifests
+	if err := yaml.Unmarshal(buf, &manifests); err != nil {
+		return fmt.Errorf("unmarshal manifest YAML: %w", err)
+	}
+	baseDir := filepath.Dir(manifestPath)
+	loader := NewResourceLoader()
+	if err := loader.LoadVaps(resolvePaths(baseDir, manifests.ValidatingAdmissionPolicies)); err != nil {
+		return fmt.Errorf("load validatingAdmissionPolicies: %w", err)
+	}
+	if err := loader.LoadResources(resolvePaths(baseDir, manifests.Resources)); err != nil {
+		return fmt.Errorf("load resources: %w", err)
+	}
+	if err := loader.check(); err != nil {
+		return fmt.Errorf("load: %w", err)
+	}
+
+	*r = repl{out: r.out, manifest: manifestPath, loader: loader, history: r.history}
+	for _, s := range manifests.TestSuites {
+		for _, tc := range s.Tests {
+			r.cases = append(r.cases, replCase{policy: s.Policy, tc: tc})
+		}
+	}
+	fmt.Fprintf(r.out, "Loaded %d policies and %d resources from %s\n", len(loader.Vaps), len(loader.Resources), manifestPath)
+	if len(r.cases) > 0 {
+		r.useCase(r.cases[0])
+		r.showContext()
+	}
+	return nil
+}
+
+// useCase sets the context to the one of the test case.
+func (r *repl) useCase(c replCase) {
+	r.policy = c.policy
+	r.object = c.tc.Object
+	r.oldObject = c.tc.OldObject
+	r.params = NameWithGVK{NamespacedName: c.tc.Param}
+	if vap, ok := r.loader.Vaps[c.policy]; ok && vap.Spec.ParamKind != nil && c.tc.Param.IsValid() {
+		r.params.GVK = gvkFromAPIVersionAndKind(vap.Spec.ParamKind.APIVersion, vap.Spec.ParamKind.Kind)
+	}
+	r.namespace = NameWithGVK{}
+	r.userInfo = c.tc.UserInfo
+}
+
+// use sets the resource used as the target.
+func (r *repl) use(args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: :use <object|oldObject|params|namespace> <ref>|-")
+	}
+	var target *NameWithGVK
+	switch args[0] {
+	case "object":
+		target = &r.object
+	case "oldObject":
+		target = &r.oldObject
+	case "params":
+		target = &r.params
+	case "namespace":
+		target = &r.namespace
+	default:
+		return fmt.Errorf("unknown target %q: must be object, oldObject, params or namespace", args[0])
+	}
+	if len(args) == 2 && args[1] == "-" {
+		*target = NameWithGVK{}
+		return nil
+	}
+	ngvk, err := parseResourceRef(args[1:])
+	if err != nil {
+		return err
+	}
+	obj, err := r.loader.GetResource(ngvk)
+	if err != nil {
+		return err
+	}
+	if obj == nil {
+		return fmt.Errorf("resource %s is not loaded", strings.Join(args[1:], " "))
+	}
+	*target = NewNameWithGVKFromObj(obj)
+	return nil
+}
+
+// parseResourceRef parses the reference to a resource in the form of "[apiVersion] Kind:[namespace/]name".
+func parseResourceRef(args []string) (NameWithGVK, error) {
+	if len(args) == 0 || len(args) > 2 {
+		return NameWithGVK{}, errors.New(`resource must be in the form of "[apiVersion] Kind:[namespace/]name"`)
+	}
+	var ngvk NameWithGVK
+	if len(args) == 2 {
+		gv, err := schema.ParseGroupVersion(args[0])
+		if err != nil {
+			return NameWithGVK{}, fmt.Errorf("parse apiVersion: %w", err)
+		}
+		ngvk.Group, ngvk.Version = gv.Group, gv.Version
+	}
+	kind, name, ok := strings.Cut(args[len(args)-1], ":")
+	if !ok || kind == "" || name == "" {
+		return NameWithGVK{}, errors.New(`resource must be in the form of "[apiVersion] Kind:[namespace/]name"`)
+	}
+	ngvk.Kind = kind
+	if ns, n, ok := strings.Cut(name, "/"); ok {
+		ngvk.Namespace, ngvk.Name = ns, n
+	} else {
+		ngvk.Name = name
+	}
+	return ngvk, nil
+}
+
+func gvkFromAPIVersionAndKind(apiVersion, kind string) GVK {
+	gvk := schema.FromAPIVersionAndKind(apiVersion, kind)
+	return GVK{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind}
+}
+
+// list writes the loaded policies, resources and test cases.
+func (r *repl) list() {
+	var b strings.Builder
+	names := make([]string, 0, len(r.loader.Vaps))
+	for name := range r.loader.Vaps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	b.WriteString("Policies:\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "  %s\n", name)
+	}
+	resources := make([]string, 0, len(r.loader.Resources))
+	for ngvk := range r.loader.Resources {
+		resources = append(resources, formatResourceRef(ngvk))
+	}
+	sort.Strings(resources)
+	b.WriteString("Resources:\n")
+	for _, res := range resources {
+		fmt.Fprintf(&b, "  %s\n", res)
+	}
+	if len(r.cases) > 0 {
+		b.WriteString("Test cases:\n")
+		for i, c := range r.cases {
+			fmt.Fprintf(&b, "  %d: %s - %s\n", i+1, c.policy, caseName(c.tc))
+		}
+	}
+	_, _ = io.WriteString(r.out, b.String())
+}
+
+// formatResourceRef returns the reference to the resource in the form accepted by parseResourceRef.
+func formatResourceRef(ngvk NameWithGVK) string {
+	if !ngvk.IsValid() {
+		return "-"
+	}
+	gv := schema.GroupVersion{Group: ngvk.Group, Version: ngvk.Version}.String()
+	name := ngvk.Kind + ":" + ngvk.NamespacedName.String()
+	if gv == "" {
+		return name
+	}
+	return gv + " " + name
+}
+
+// showContext writes the current context.
+func (r *repl) showContext() {
+	policy := r.policy
+	if policy == "" {
+		policy = "-"
+	}
+	user := "-"
+	if r.userInfo.Name != "" || len(r.userInfo.Groups) > 0 {
+		user = fmt.Sprintf("%s %v", r.userInfo.Name, r.userInfo.Groups)
+	}
+	fmt.Fprintf(r.out, "policy:    %s\nobject:    %s\noldObject: %s\nparams:    %s\nnamespace: %s\nuser:      %s\n",
+		policy, formatResourceRef(r.object), formatResourceRef(r.oldObject), formatResourceRef(r.params), formatResourceRef(r.namespace), user)
+}
+
+// validationParams returns the params to evaluate the expressions in the current context.
+func (r *repl) validationParams() (kaptest.ValidationParams, error) {
+	var p kaptest.ValidationParams
+	obj, err := r.loader.GetResource(r.object)
+	if err != nil {
+		return p, fmt.Errorf("get object: %w", err)
+	}
+	oldObj, err := r.loader.GetResource(r.oldObject)
+	if err != nil {
+		return p, fmt.Errorf("get oldObject: %w", err)
+	}
+	if obj == nil && oldObj == nil {
+		return p, errors.New(`object or oldObject is required; select them by ":use" or ":case"`)
+	}
+	if obj != nil {
+		p.Object = obj
+	}
+	if oldObj != nil {
+		p.OldObject = oldObj
+	}
+	if r.params.IsValid() {
+		paramObj, err := r.loader.GetResource(r.params)
+		if err != nil {
+			return p, fmt.Errorf("get params: %w", err)
+		}
+		if paramObj != nil {
+			p.ParamObj = paramObj
+		}
+	}
+	if r.namespace.IsValid() {
+		nsObj, err := r.loader.GetResource(r.namespace)
+		if err != nil {
+			return p, fmt.Errorf("get namespace: %w", err)
+		}
+		var ns corev1.Namespace
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(nsObj.Object, &ns); err != nil {
+			return p, fmt.Errorf("convert namespace: %w", err)
+		}
+		p.NamespaceObj = &ns
+	} else if p.NamespaceObj, err = getNamespaceObj(r.loader, obj, oldObj); err != nil {
+		return p, fmt.Errorf("get namespace: %w", err)
+	}
+	userInfo := NewK8sUserInfo(r.userInfo)
+	p.UserInfo = &userInfo
+	return p, nil
+}
+
+// eval evaluates the expression in the current context and writes the value, its type and cost.
+func (r *repl) eval(expression string) {
+	p, err := r.validationParams()
+	if err != nil {
+		fmt.Fprintf(r.out, "error: %v\n", err)
+		return
+	}
+	result := kaptest.EvalExpression(r.loader.Vaps[r.policy], expression, p)
+	if result.Error != nil {
+		fmt.Fprintf(r.out, "error: %v\n", result.Error)
+		return
+	}
+	fmt.Fprintf(r.out, "%s\n(type: %s, cost: %d)\n", formatValue(result.Value), result.Value.Type().TypeName(), result.Cost)
+}
+
+// formatValue returns the value in JSON if possible.
+func formatValue(v ref.Val) string {
+	if native, err := v.ConvertToNative(reflect.TypeOf(&structpb.Value{})); err == nil {
+		if b, err := json.Marshal(native.(*structpb.Value).AsInterface()); err == nil {
+			return string(b)
+		}
+	}
+	if b, err := json.Marshal(v.Value()); err == nil {
+		return string(b)
+	}
+	return fmt.Sprint(v.Value())
+}
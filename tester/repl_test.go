@@ -0,0 +1,107 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestREPL_Run(t *testing.T) {
+	t.Parallel()
+	var out bytes.Buffer
+	r := newREPL(&out)
+	mustNil(t, r.load("testdata/vap-with-params.test/kaptest.yaml"))
+	out.Reset()
+
+	input := strings.Join([]string{
+		"variables.replicas <= int(params.data.maxReplicas)",
+		":case 2",
+		"variables.replicas <= int(params.data.maxReplicas)",
+		":use object apps/v1 Deployment:ok",
+		":user alice dev",
+		"request.userInfo.username + ' ' + request.userInfo.groups[0]",
+		"object.",
+		":use object Deployment:not-found",
+		"!1",
+		":quit",
+		"1",
+	}, "\n")
+	mustNil(t, r.run(strings.NewReader(input), false))
+
+	want := []string{
+		"true\n(type: bool, cost: ",
+		"object:    Deployment:bad\n",
+		"false\n(type: bool, cost: ",
+		"\"alice dev\"\n(type: string, cost: ",
+		"error: compilation error",
+		"error: resource Deployment:not-found is not loaded",
+		"variables.replicas <= int(params.data.maxReplicas)\ntrue\n",
+	}
+	got := out.String()
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("output does not contain %q:\n%s", w, got)
+		}
+		got = got[strings.Index(got, w)+len(w):]
+	}
+	if len(r.history) != 5 {
+		t.Errorf("history = %q, want 5 expressions", r.history)
+	}
+}
+
+func TestParseResourceRef(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		args    []string
+		want    NameWithGVK
+		wantErr bool
+	}{
+		{
+			name: "ok: kind and name",
+			args: []string{"Deployment:foo"},
+			want: NameWithGVK{GVK: GVK{Kind: "Deployment"}, NamespacedName: NamespacedName{Name: "foo"}},
+		},
+		{
+			name: "ok: apiVersion and namespace",
+			args: []string{"apps/v1", "Deployment:default/foo"},
+			want: NameWithGVK{GVK: GVK{Group: "apps", Version: "v1", Kind: "Deployment"}, NamespacedName: NamespacedName{Namespace: "default", Name: "foo"}},
+		},
+		{
+			name: "ok: core group",
+			args: []string{"v1", "ConfigMap:foo"},
+			want: NameWithGVK{GVK: GVK{Version: "v1", Kind: "ConfigMap"}, NamespacedName: NamespacedName{Name: "foo"}},
+		},
+		{name: "err: no name", args: []string{"Deployment"}, wantErr: true},
+		{name: "err: invalid apiVersion", args: []string{"a/b/c", "Deployment:foo"}, wantErr: true},
+		{name: "err: too many args", args: []string{"apps/v1", "Deployment:foo", "bar"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseResourceRef(tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseResourceRef() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseResourceRef() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
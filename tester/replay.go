@@ -0,0 +1,581 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pfnet/kaptest"
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	auditv1 "k8s.io/apiserver/pkg/apis/audit/v1"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// defaultReplaySamples is the default number of the sample denials kept for each policy.
+const defaultReplaySamples = 5
+
+// ReplayOptions is the options of RunReplay.
+type ReplayOptions struct {
+	// Policies is the list of the files, directories or glob patterns of the policies to evaluate.
+	Policies []string
+	// Resources is the list of the files, directories or glob patterns of the bindings, params and namespaces.
+	Resources []string
+	// AuditLog is the path to the audit log in JSON lines. The log is read from stdin if the path is "-".
+	AuditLog string
+	// Samples is the maximum number of the sample denials for each policy. 5 is used if zero.
+	Samples int
+	// StrictNamespaces makes the requests in Namespaces not in the resources errors,
+	// instead of using Namespaces without labels and annotations.
+	StrictNamespaces bool
+	// Output is the output format, either text or json.
+	Output OutputFormat
+}
+
+// ReplayReport is the aggregated results of the requests replayed from an audit log.
+type ReplayReport struct {
+	// Events is the number of the audit events read.
+	Events int `json:"events"`
+	// Requests is the number of the mutating requests replayed.
+	Requests int `json:"requests"`
+	// Skipped is the number of the mutating requests which cannot be reconstructed, grouped by the reason.
+	Skipped  []ReplayCount        `json:"skipped,omitempty"`
+	Policies []PolicyReplayReport `json:"policies"`
+}
+
+// PolicyReplayReport is the results of a policy and a binding of it.
+type PolicyReplayReport struct {
+	Policy string `json:"policy"`
+	// Binding is the name of the ValidatingAdmissionPolicyBinding.
+	// It is empty if no binding of the policy is loaded, in which case the policy applies to all the requests it matches.
+	Binding string `json:"binding,omitempty"`
+	// ValidationActions is the actions of the binding on the requests failing the validations.
+	ValidationActions []v1.ValidationAction `json:"validationActions"`
+	// Matched is the number of the requests matching the policy and the binding.
+	Matched int `json:"matched"`
+	Admit   int `json:"admit"`
+	// Deny is the number of the requests denied.
+	// The requests failing the validations of a binding without the Deny action are counted in Warn and Audit instead.
+	Deny  int `json:"deny"`
+	Warn  int `json:"warn"`
+	Audit int `json:"audit"`
+	Error int `json:"error"`
+	Skip  int `json:"skip"`
+
+	DenialsByUser      []ReplayCount `json:"denialsByUser,omitempty"`
+	DenialsByNamespace []ReplayCount `json:"denialsByNamespace,omitempty"`
+	DenialsByMessage   []ReplayCount `json:"denialsByMessage,omitempty"`
+	ErrorsByMessage    []ReplayCount `json:"errorsByMessage,omitempty"`
+	// Samples is the first denied requests in the audit log.
+	Samples []ReplaySample `json:"samples,omitempty"`
+
+	counts map[string]map[string]int
+}
+
+// ReplayCount is the number of the requests grouped by the key.
+type ReplayCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// ReplaySample is a request denied by the policy.
+type ReplaySample struct {
+	AuditID   string `json:"auditID"`
+	Timestamp string `json:"timestamp,omitempty"`
+	User      string `json:"user"`
+	Namespace string `json:"namespace,omitempty"`
+	// Name is the human-readable name of the request, e.g. "(UPDATE) Deployment:foo/bar".
+	Name     string   `json:"name"`
+	Messages []string `json:"messages"`
+}
+
+// RunReplay replays the requests in the audit log against the policies and writes the results to stdout.
+func RunReplay(opts ReplayOptions) error {
+	if opts.Output == "" {
+		opts.Output = OutputText
+	}
+	if opts.Output != OutputText && opts.Output != OutputJSON {
+		return fmt.Errorf("unsupported output format %q: must be text or json", opts.Output)
+	}
+	report, err := Replay(opts, os.Stdin)
+	if err != nil {
+		return err
+	}
+	if opts.Output == OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	writeReplayText(os.Stdout, report)
+	return nil
+}
+
+// Replay reconstructs the mutating requests from the audit events and evaluates the policies against them.
+// The audit log is read from stdin if opts.AuditLog is "-".
+func Replay(opts ReplayOptions, stdin io.Reader) (ReplayReport, error) {
+	if opts.AuditLog == "" {
+		return ReplayReport{}, errors.New("audit log is required")
+	}
+	loader := NewResourceLoader()
+	loader.StrictNamespaces = opts.StrictNamespaces
+	if err := loader.LoadVaps(opts.Policies); err != nil {
+		return ReplayReport{}, fmt.Errorf("load policies: %w", err)
+	}
+	if err := loader.LoadResources(opts.Resources); err != nil {
+		return ReplayReport{}, fmt.Errorf("load resources: %w", err)
+	}
+	if err := loader.check(); err != nil {
+		return ReplayReport{}, fmt.Errorf("load: %w", err)
+	}
+	if len(loader.Vaps) == 0 {
+		return ReplayReport{}, errors.New("no ValidatingAdmissionPolicy found")
+	}
+	r, err := newReplayer(loader, opts.Samples)
+	if err != nil {
+		return ReplayReport{}, err
+	}
+
+	in := stdin
+	if opts.AuditLog != stdinPath {
+		f, err := os.Open(opts.AuditLog)
+		if err != nil {
+			return ReplayReport{}, fmt.Errorf("open audit log: %w", err)
+		}
+		defer f.Close()
+		in = f
+	}
+	reader := bufio.NewReader(in)
+	for n := 1; ; n++ {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var ev auditv1.Event
+			if uerr := json.Unmarshal(line, &ev); uerr != nil {
+				slog.Warn("failed to decode audit event", "line", n, "error", uerr)
+				r.report.Events++
+				r.skip("invalid audit event")
+			} else {
+				r.replay(&ev)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ReplayReport{}, fmt.Errorf("read audit log: %w", err)
+		}
+	}
+	return r.result(), nil
+}
+
+type replayer struct {
+	loader     *ResourceLoader
+	targets    []policyTarget
+	reports    []*PolicyReplayReport
+	namespaces *namespaceCache
+	samples    int
+	// objects is the latest states of the objects in the responses, which are used as the old objects.
+	objects map[auditObjectKey]*unstructured.Unstructured
+	skipped map[string]int
+	report  ReplayReport
+}
+
+type auditObjectKey struct {
+	group, resource, subresource, namespace, name string
+}
+
+func newReplayer(loader *ResourceLoader, samples int) (*replayer, error) {
+	if samples <= 0 {
+		samples = defaultReplaySamples
+	}
+	targets, err := newPolicyTargets(loader)
+	if err != nil {
+		return nil, err
+	}
+	reports := make([]*PolicyReplayReport, len(targets))
+	for i, t := range targets {
+		reports[i] = &PolicyReplayReport{
+			Policy:            t.vap.Name,
+			Binding:           t.bindingName(),
+			ValidationActions: t.validationActions(),
+			counts:            map[string]map[string]int{},
+		}
+	}
+	return &replayer{
+		loader:     loader,
+		targets:    targets,
+		reports:    reports,
+		namespaces: newNamespaceCache(loader),
+		samples:    samples,
+		objects:    map[auditObjectKey]*unstructured.Unstructured{},
+		skipped:    map[string]int{},
+	}, nil
+}
+
+func (r *replayer) skip(reason string) {
+	r.skipped[reason]++
+}
+
+// replayedRequest is a mutating request reconstructed from an audit event.
+type replayedRequest struct {
+	admissionRequest
+	event *auditv1.Event
+}
+
+// replay evaluates the policies against the request of the audit event, and records the object in the response.
+func (r *replayer) replay(ev *auditv1.Event) {
+	r.report.Events++
+	// Each request is logged at several stages. Only the last one has the response.
+	if ev.Stage != auditv1.StageResponseComplete || ev.ObjectRef == nil {
+		return
+	}
+	key := auditObjectKey{
+		group:       ev.ObjectRef.APIGroup,
+		resource:    ev.ObjectRef.Resource,
+		subresource: ev.ObjectRef.Subresource,
+		namespace:   ev.ObjectRef.Namespace,
+		name:        ev.ObjectRef.Name,
+	}
+	succeeded := ev.ResponseStatus == nil || ev.ResponseStatus.Code < 300
+	response := auditObject(ev.ResponseObject)
+
+	if op, ok := auditOperations[ev.Verb]; ok {
+		req, reason := r.reconstruct(ev, op, key, succeeded, response)
+		if req == nil {
+			r.skip(reason)
+		} else {
+			r.report.Requests++
+			r.evaluate(req)
+		}
+	}
+
+	// Dry-run requests are not persisted by the API server.
+	if !succeeded || key.name == "" || auditDryRun(ev) {
+		return
+	}
+	if ev.Verb == "delete" {
+		delete(r.objects, key)
+	} else if response != nil {
+		r.objects[key] = response
+	}
+}
+
+// auditOperations is the admission operations of the mutating verbs.
+var auditOperations = map[string]admission.Operation{
+	"create": admission.Create,
+	"update": admission.Update,
+	"patch":  admission.Update,
+	"delete": admission.Delete,
+}
+
+// auditDryRun returns whether the request of the audit event is a dry run, i.e. has the dryRun query parameter.
+func auditDryRun(ev *auditv1.Event) bool {
+	u, err := url.Parse(ev.RequestURI)
+	return err == nil && len(u.Query()["dryRun"]) > 0
+}
+
+// reconstruct returns the request of the audit event, or the reason why it cannot be reconstructed.
+// The old object of UPDATE and DELETE is the latest state of the object recorded before the event.
+func (r *replayer) reconstruct(ev *auditv1.Event, op admission.Operation, key auditObjectKey, succeeded bool, response *unstructured.Unstructured) (*replayedRequest, string) {
+	var obj, oldObj *unstructured.Unstructured
+	switch ev.Verb {
+	case "create", "update":
+		// The response has the defaults and the mutations applied on admission.
+		obj = response
+		if obj == nil || !succeeded {
+			obj = auditObject(ev.RequestObject)
+		}
+	case "patch":
+		// The request object is the patch.
+		obj = response
+	}
+	switch op {
+	case admission.Update:
+		if obj == nil {
+			return nil, "object is not recorded"
+		}
+		if oldObj = r.objects[key]; oldObj == nil {
+			return nil, "oldObject is not recorded"
+		}
+	case admission.Delete:
+		if oldObj = r.objects[key]; oldObj == nil && succeeded {
+			oldObj = response
+		}
+		if oldObj == nil {
+			return nil, "oldObject is not recorded"
+		}
+	default:
+		if obj == nil {
+			return nil, "object is not recorded"
+		}
+	}
+
+	ref := obj
+	if ref == nil {
+		ref = oldObj
+	}
+	gvk := ref.GroupVersionKind()
+	name := ev.ObjectRef.Name
+	if name == "" {
+		name = ref.GetName()
+	}
+	userInfo := ev.User
+	if ev.ImpersonatedUser != nil {
+		userInfo = *ev.ImpersonatedUser
+	}
+	extra := make(map[string][]string, len(userInfo.Extra))
+	for k, v := range userInfo.Extra {
+		extra[k] = v
+	}
+
+	req := &replayedRequest{event: ev}
+	req.admissionRequest = admissionRequest{
+		obj:    obj,
+		oldObj: oldObj,
+		attrs: &kaptest.RequestAttributes{
+			Operation: op,
+			Kind:      gvk,
+			Resource: schema.GroupVersionResource{
+				Group:    ev.ObjectRef.APIGroup,
+				Version:  ev.ObjectRef.APIVersion,
+				Resource: ev.ObjectRef.Resource,
+			},
+			SubResource: ev.ObjectRef.Subresource,
+			Namespace:   ev.ObjectRef.Namespace,
+			Name:        name,
+			DryRun:      auditDryRun(ev),
+		},
+		userInfo: &user.DefaultInfo{Name: userInfo.Username, UID: userInfo.UID, Groups: userInfo.Groups, Extra: extra},
+	}
+	ngvk := NameWithGVK{
+		GVK:            GVK{Group: gvk.Group, Version: gvk.Version, Kind: gvk.Kind},
+		NamespacedName: NamespacedName{Namespace: ev.ObjectRef.Namespace, Name: name},
+	}
+	if obj != nil {
+		req.tc.Object = ngvk
+	}
+	if oldObj != nil {
+		req.tc.OldObject = ngvk
+	}
+	return req, ""
+}
+
+// auditObject returns the object recorded in the audit event. It returns nil for a Status or a non-object.
+func auditObject(u *runtime.Unknown) *unstructured.Unstructured {
+	if u == nil || !hasRawObject(runtime.RawExtension{Raw: u.Raw}) {
+		return nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(u.Raw, &obj); err != nil {
+		return nil
+	}
+	o := &unstructured.Unstructured{Object: obj}
+	if o.GetKind() == "" || o.GetKind() == "Status" {
+		return nil
+	}
+	return o
+}
+
+// evaluate evaluates the policies against the request.
+func (r *replayer) evaluate(req *replayedRequest) {
+	namespaceObj, err := r.namespaces.get(requestNamespace(r.loader, req.attrs.Kind.GroupKind(), req.attrs.Namespace))
+	for i, t := range r.targets {
+		if err != nil {
+			r.record(r.reports[i], req, newSetupErrorResult(req.tc, []error{err}))
+			continue
+		}
+		if c, matched := evalTarget(r.loader, t, &req.admissionRequest, namespaceObj); matched {
+			r.record(r.reports[i], req, c)
+		}
+	}
+}
+
+// record adds the result of the request to the report of the policy.
+// Only the requests denied by the binding are counted and sampled as denials.
+func (r *replayer) record(p *PolicyReplayReport, req *replayedRequest, c CaseReport) {
+	p.Matched++
+	switch c.Result {
+	case ResultAdmit:
+		p.Admit++
+	case ResultDeny:
+		if !hasAction(p.ValidationActions, v1.Deny) {
+			countNotDenied(p.ValidationActions, &p.Warn, &p.Audit)
+			return
+		}
+		p.Deny++
+	case ResultSkip:
+		p.Skip++
+	default:
+		p.Error++
+	}
+
+	var messages []string
+	for _, d := range c.Decisions {
+		if d.Evaluation == c.Result || (c.Result != ResultDeny && d.Evaluation == ResultError) {
+			messages = append(messages, d.Message)
+		}
+	}
+	messages = append(messages, c.Errors...)
+	switch c.Result {
+	case ResultAdmit, ResultSkip:
+		return
+	case ResultDeny:
+		p.count("user", req.userInfo.Name)
+		p.count("namespace", req.attrs.Namespace)
+		for _, m := range messages {
+			p.count("message", m)
+		}
+		if len(p.Samples) < r.samples {
+			sample := ReplaySample{
+				AuditID:   string(req.event.AuditID),
+				User:      req.userInfo.Name,
+				Namespace: req.attrs.Namespace,
+				Name:      c.Name,
+				Messages:  messages,
+			}
+			if !req.event.RequestReceivedTimestamp.IsZero() {
+				sample.Timestamp = req.event.RequestReceivedTimestamp.UTC().Format("2006-01-02T15:04:05Z")
+			}
+			p.Samples = append(p.Samples, sample)
+		}
+	default:
+		for _, m := range messages {
+			p.count("error", m)
+		}
+	}
+}
+
+func (p *PolicyReplayReport) count(group, key string) {
+	if p.counts[group] == nil {
+		p.counts[group] = map[string]int{}
+	}
+	p.counts[group][key]++
+}
+
+// result returns the report with the counts sorted in descending order.
+func (r *replayer) result() ReplayReport {
+	report := r.report
+	report.Skipped = sortCounts(r.skipped)
+	report.Policies = make([]PolicyReplayReport, 0, len(r.reports))
+	for _, rp := range r.reports {
+		p := *rp
+		p.DenialsByUser = sortCounts(p.counts["user"])
+		p.DenialsByNamespace = sortCounts(p.counts["namespace"])
+		p.DenialsByMessage = sortCounts(p.counts["message"])
+		p.ErrorsByMessage = sortCounts(p.counts["error"])
+		p.counts = nil
+		report.Policies = append(report.Policies, p)
+	}
+	return report
+}
+
+func sortCounts(m map[string]int) []ReplayCount {
+	if len(m) == 0 {
+		return nil
+	}
+	counts := make([]ReplayCount, 0, len(m))
+	for k, n := range m {
+		counts = append(counts, ReplayCount{Key: k, Count: n})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return counts[i].Key < counts[j].Key
+	})
+	return counts
+}
+
+// writeReplayText writes the results of Replay in the human-readable format.
+func writeReplayText(w io.Writer, r ReplayReport) {
+	var b strings.Builder
+	skipped := 0
+	for _, s := range r.Skipped {
+		skipped += s.Count
+	}
+	fmt.Fprintf(&b, "Replayed %d requests from %d audit events (%d skipped)\n", r.Requests, r.Events, skipped)
+	for _, s := range r.Skipped {
+		fmt.Fprintf(&b, "  SKIPPED %d: %s\n", s.Count, s.Key)
+	}
+	for _, p := range r.Policies {
+		name := p.Policy
+		if p.Binding != "" {
+			name += " (binding: " + p.Binding + ")"
+		}
+		fmt.Fprintf(&b, "\n%s\n", name)
+		writeMatchedCounts(&b, p.ValidationActions, p.Matched, p.Admit, p.Deny, p.Warn, p.Audit, p.Error, p.Skip)
+		writeReplayCounts(&b, "denials by user", p.DenialsByUser)
+		writeReplayCounts(&b, "denials by namespace", p.DenialsByNamespace)
+		writeReplayCounts(&b, "denials by message", p.DenialsByMessage)
+		writeReplayCounts(&b, "errors by message", p.ErrorsByMessage)
+		if len(p.Samples) > 0 {
+			b.WriteString("  sample denials:\n")
+		}
+		for _, s := range p.Samples {
+			fmt.Fprintf(&b, "    - %s by %s", s.Name, s.User)
+			if s.Timestamp != "" {
+				fmt.Fprintf(&b, " at %s", s.Timestamp)
+			}
+			fmt.Fprintf(&b, " (auditID: %s)\n", s.AuditID)
+			for _, m := range s.Messages {
+				fmt.Fprintf(&b, "      %q\n", m)
+			}
+		}
+	}
+	_, _ = io.WriteString(w, b.String())
+}
+
+// writeMatchedCounts writes the number of the matched requests by the result.
+// The warnings and the audits are written only if the binding has the actions but not Deny.
+func writeMatchedCounts(b *strings.Builder, actions []v1.ValidationAction, matched, admit, deny, warn, audit, errs, skip int) {
+	fmt.Fprintf(b, "  matched %d: admit %d, deny %d", matched, admit, deny)
+	if !hasAction(actions, v1.Deny) {
+		if hasAction(actions, v1.Warn) {
+			fmt.Fprintf(b, ", warn %d", warn)
+		}
+		if hasAction(actions, v1.Audit) {
+			fmt.Fprintf(b, ", audit %d", audit)
+		}
+	}
+	fmt.Fprintf(b, ", error %d, skip %d\n", errs, skip)
+}
+
+func writeReplayCounts(b *strings.Builder, title string, counts []ReplayCount) {
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(b, "  %s:\n", title)
+	for _, c := range counts {
+		key := c.Key
+		if key == "" {
+			key = "(none)"
+		}
+		fmt.Fprintf(b, "    %d\t%s\n", c.Count, key)
+	}
+}
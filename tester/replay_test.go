@@ -0,0 +1,202 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+)
+
+func TestReplay(t *testing.T) {
+	t.Parallel()
+	path := func(name string) string { return filepath.Join("testdata/replay.test", name) }
+	auditLog, err := os.ReadFile(path("audit.log"))
+	mustNil(t, err)
+
+	opts := ReplayOptions{
+		Policies:  []string{path("policy.yaml")},
+		Resources: []string{path("resources.yaml")},
+		AuditLog:  path("audit.log"),
+		Samples:   1,
+	}
+	got, err := Replay(opts, nil)
+	mustNil(t, err)
+	want := ReplayReport{
+		Events:   10,
+		Requests: 5,
+		Skipped: []ReplayCount{
+			{Key: "invalid audit event", Count: 1},
+			{Key: "object is not recorded", Count: 1},
+			{Key: "oldObject is not recorded", Count: 1},
+		},
+		Policies: []PolicyReplayReport{{
+			Policy:             "deployment-replicas",
+			Binding:            "deployment-replicas-prod",
+			ValidationActions:  []v1.ValidationAction{v1.Deny},
+			Matched:            3,
+			Admit:              1,
+			Deny:               2,
+			DenialsByUser:      []ReplayCount{{Key: "bob", Count: 1}, {Key: "carol", Count: 1}},
+			DenialsByNamespace: []ReplayCount{{Key: "foo", Count: 2}},
+			DenialsByMessage:   []ReplayCount{{Key: "replicas must be equal or less than 5", Count: 2}},
+			Samples: []ReplaySample{{
+				AuditID:   "2",
+				Timestamp: "2024-01-02T03:04:05Z",
+				User:      "bob",
+				Namespace: "foo",
+				Name:      "(UPDATE) Deployment:foo/ok -> foo/ok",
+				Messages:  []string{"replicas must be equal or less than 5"},
+			}},
+		}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Replay() = %+v, want %+v", got, want)
+	}
+
+	// Without the binding, the params cannot be resolved.
+	opts.Resources = nil
+	opts.AuditLog = stdinPath
+	got, err = Replay(opts, bytes.NewReader(auditLog))
+	mustNil(t, err)
+	if p := got.Policies[0]; p.Binding != "" || p.Matched != 4 || p.Error != 4 || len(p.ErrorsByMessage) != 1 {
+		t.Errorf("unexpected report without bindings: %+v", p)
+	}
+
+	if _, err := Replay(ReplayOptions{Policies: []string{path("policy.yaml")}}, nil); err == nil {
+		t.Errorf("Replay() without audit log error = nil, want error")
+	}
+	if _, err := Replay(ReplayOptions{Policies: []string{path("audit.log")}, AuditLog: path("audit.log")}, nil); err == nil {
+		t.Errorf("Replay() without policies error = nil, want error")
+	}
+}
+
+func TestReplay_ValidationActions(t *testing.T) {
+	t.Parallel()
+	// The params are looked up in the namespace of each request since paramRef.namespace is empty.
+	got, err := Replay(ReplayOptions{
+		Policies:  []string{"testdata/replay.test/policy.yaml"},
+		Resources: []string{"testdata/replay.test/resources-warn.yaml"},
+		AuditLog:  "testdata/replay.test/audit.log",
+	}, nil)
+	mustNil(t, err)
+	want := PolicyReplayReport{
+		Policy:            "deployment-replicas",
+		Binding:           "deployment-replicas-warn",
+		ValidationActions: []v1.ValidationAction{v1.Warn, v1.Audit},
+		Matched:           3,
+		Admit:             1,
+		Warn:              2,
+		Audit:             2,
+	}
+	if !reflect.DeepEqual(got.Policies, []PolicyReplayReport{want}) {
+		t.Errorf("Replay().Policies = %+v, want %+v", got.Policies, want)
+	}
+}
+
+func TestReplay_DryRun(t *testing.T) {
+	t.Parallel()
+	// The dry-run DELETE does not remove the object, and the dry-run CREATE does not record it.
+	got, err := Replay(ReplayOptions{
+		Policies:  []string{"testdata/replay.test/policy.yaml"},
+		Resources: []string{"testdata/replay.test/resources.yaml"},
+		AuditLog:  "testdata/replay.test/audit-dry-run.log",
+	}, nil)
+	mustNil(t, err)
+	if got.Events != 5 || got.Requests != 4 {
+		t.Errorf("events, requests = %d, %d, want 5, 4", got.Events, got.Requests)
+	}
+	if want := []ReplayCount{{Key: "oldObject is not recorded", Count: 1}}; !reflect.DeepEqual(got.Skipped, want) {
+		t.Errorf("Replay().Skipped = %+v, want %+v", got.Skipped, want)
+	}
+	if p := got.Policies[0]; p.Matched != 3 || p.Admit != 3 || p.Deny != 0 {
+		t.Errorf("matched, admit, deny = %d, %d, %d, want 3, 3, 0", p.Matched, p.Admit, p.Deny)
+	}
+}
+
+func TestReplay_NamespaceObject(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name               string
+		strict             bool
+		admit, deny, error int
+	}{
+		{name: "ok: a missing namespace is synthesized", admit: 1, deny: 2},
+		{name: "ok: a missing namespace is an error in the strict mode", strict: true, admit: 1, deny: 1, error: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := Replay(ReplayOptions{
+				Policies:         []string{"testdata/vap-with-namespace-object.yaml"},
+				Resources:        []string{"testdata/vap-with-namespace-object.test/resources.yaml"},
+				AuditLog:         "testdata/vap-with-namespace-object.test/audit.log",
+				StrictNamespaces: tt.strict,
+			}, nil)
+			mustNil(t, err)
+			// The cluster-scoped Gadget is admitted even though the request has a namespace.
+			if p := got.Policies[0]; p.Admit != tt.admit || p.Deny != tt.deny || p.Error != tt.error {
+				t.Errorf("admit, deny, error = %d, %d, %d, want %d, %d, %d", p.Admit, p.Deny, p.Error, tt.admit, tt.deny, tt.error)
+			}
+		})
+	}
+}
+
+func TestWriteReplayText(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	writeReplayText(&buf, ReplayReport{
+		Events:   3,
+		Requests: 2,
+		Skipped:  []ReplayCount{{Key: "oldObject is not recorded", Count: 1}},
+		Policies: []PolicyReplayReport{{
+			Policy:             "deployment-replicas",
+			Binding:            "prod",
+			Matched:            2,
+			Admit:              1,
+			Deny:               1,
+			DenialsByUser:      []ReplayCount{{Key: "bob", Count: 1}},
+			DenialsByNamespace: []ReplayCount{{Key: "", Count: 1}},
+			Samples: []ReplaySample{{
+				AuditID:  "2",
+				User:     "bob",
+				Name:     "(CREATE) Deployment:bad",
+				Messages: []string{"too many"},
+			}},
+		}},
+	})
+	want := `Replayed 2 requests from 3 audit events (1 skipped)
+  SKIPPED 1: oldObject is not recorded
+
+deployment-replicas (binding: prod)
+  matched 2: admit 1, deny 1, error 0, skip 0
+  denials by user:
+    1	bob
+  denials by namespace:
+    1	(none)
+  sample denials:
+    - (CREATE) Deployment:bad by bob (auditID: 2)
+      "too many"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeReplayText() = %q, want %q", got, want)
+	}
+}
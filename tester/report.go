@@ -0,0 +1,172 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import "time"
+
+// ReportSchemaVersion is the version of the schema of Report.
+// It is incremented when a backward incompatible change is made to the schema.
+const ReportSchemaVersion = "v1"
+
+// Result is the result of a test case or the evaluation of a validation.
+type Result string
+
+const (
+	ResultAdmit Result = "admit"
+	ResultDeny  Result = "deny"
+	ResultError Result = "error"
+	ResultSkip  Result = "skip"
+	// ResultSetupError is the result of a test case which cannot be run, e.g. the object is not found.
+	ResultSetupError Result = "setup_error"
+	// ResultFatalError is the result of a test case whose validations cannot be run.
+	ResultFatalError Result = "fatal_error"
+)
+
+// Report is the results of the test manifests, organized as manifest -> suite -> case -> decision.
+// It is written as it is by the JSON output format.
+type Report struct {
+	SchemaVersion string           `json:"schemaVersion"`
+	Manifests     []ManifestReport `json:"manifests"`
+	// UntestedPolicies is the list of policies found in the searched directories without tests.
+	UntestedPolicies []UntestedPolicy `json:"untestedPolicies,omitempty"`
+	Total            int              `json:"total"`
+	Pass             int              `json:"pass"`
+	Fail             int              `json:"fail"`
+	// Duration is the time taken to run all the manifests in seconds.
+	Duration float64 `json:"duration"`
+}
+
+// ManifestReport is the results of a test manifest.
+type ManifestReport struct {
+	Path string `json:"path"`
+	// Error is set when the manifest cannot be run, e.g. the manifest is invalid.
+	// It is counted as a single failure.
+	Error string `json:"error,omitempty"`
+	// LoadIssues is the problems found while loading the policies and the resources.
+	// The manifest fails if any of them is an error, or a warning when warnings are treated as errors.
+	LoadIssues []LoadIssue   `json:"loadIssues,omitempty"`
+	Suites     []SuiteReport `json:"suites"`
+	Total      int           `json:"total"`
+	Pass       int           `json:"pass"`
+	Fail       int           `json:"fail"`
+	Duration   float64       `json:"duration"`
+}
+
+// SuiteReport is the results of the test cases for a single policy.
+type SuiteReport struct {
+	Policy string `json:"policy"`
+	// Position is the position of the test suite in the manifest.
+	Position *Position `json:"position,omitempty"`
+	// Error is set when the policy cannot be evaluated, e.g. the policy is not found.
+	// It is counted as a single failure.
+	Error string       `json:"error,omitempty"`
+	Cases []CaseReport `json:"cases"`
+}
+
+// CaseReport is the result of a single test case.
+type CaseReport struct {
+	// Name is the human-readable name of the test case, e.g. "(CREATE) Deployment:foo".
+	Name string `json:"name"`
+	// Position is the position of the test case in the manifest.
+	Position *Position `json:"position,omitempty"`
+	// Operation is one of CREATE, UPDATE and DELETE.
+	Operation string               `json:"operation,omitempty"`
+	Object    *NameWithGVK         `json:"object,omitempty"`
+	OldObject *NameWithGVK         `json:"oldObject,omitempty"`
+	Param     *NamespacedName      `json:"param,omitempty"`
+	Expect    PolicyDecisionExpect `json:"expect"`
+	// Result is one of admit, deny, error, skip, setup_error and fatal_error.
+	Result    Result           `json:"result"`
+	Pass      bool             `json:"pass"`
+	Decisions []DecisionReport `json:"decisions,omitempty"`
+	// AuditAnnotations is the audit annotations published by the policy.
+	AuditAnnotations []AuditAnnotationReport `json:"auditAnnotations,omitempty"`
+	// Warnings is the warnings which the API server returns for the request
+	// by the ValidatingAdmissionPolicyBindings of the policy with the Warn action in the resources.
+	Warnings []string `json:"warnings,omitempty"`
+	// FailedMatchCondition is the name of the matchCondition evaluated as false when Result is skip.
+	FailedMatchCondition string   `json:"failedMatchCondition,omitempty"`
+	Errors               []string `json:"errors,omitempty"`
+	// ExpressionPosition is the position of the matchCondition which caused the errors when Result is error.
+	ExpressionPosition *Position `json:"expressionPosition,omitempty"`
+	// SnapshotMismatch is the difference from the snapshot, or the reason why it cannot be compared,
+	// when the test case opts into the snapshot and the results do not match it.
+	SnapshotMismatch string `json:"snapshotMismatch,omitempty"`
+	// Duration is the time taken to run the test case in seconds.
+	Duration float64 `json:"duration"`
+}
+
+// DecisionReport is a decision of a validation in the policy.
+type DecisionReport struct {
+	// Evaluation is one of admit, deny and error.
+	Evaluation Result `json:"evaluation"`
+	Reason     string `json:"reason,omitempty"`
+	Message    string `json:"message,omitempty"`
+	// Position is the position of the expression in the policy which caused deny or error.
+	Position *Position `json:"position,omitempty"`
+
+	// validation is the index of the validation in spec.validations which made the decision.
+	// It is nil if the decision is not made by a single validation, e.g. an error evaluating the variables.
+	validation *int
+}
+
+// AuditAnnotationReport is an audit annotation of the policy.
+type AuditAnnotationReport struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// Error is set when the valueExpression cannot be evaluated.
+	Error string `json:"error,omitempty"`
+}
+
+func newReport(manifests []ManifestReport, untested []UntestedPolicy, duration time.Duration) Report {
+	r := Report{
+		SchemaVersion:    ReportSchemaVersion,
+		Manifests:        manifests,
+		UntestedPolicies: untested,
+		Duration:         duration.Seconds(),
+	}
+	if r.Manifests == nil {
+		r.Manifests = []ManifestReport{}
+	}
+	for _, m := range manifests {
+		r.Total += m.Total
+		r.Pass += m.Pass
+		r.Fail += m.Fail
+	}
+	return r
+}
+
+// count sets Total, Pass and Fail of the manifest from its suites.
+// A suite with an error is counted as a single failure.
+func (m *ManifestReport) count() {
+	m.Total, m.Pass, m.Fail = 0, 0, 0
+	for _, s := range m.Suites {
+		if s.Error != "" {
+			m.Total++
+			m.Fail++
+			continue
+		}
+		for _, c := range s.Cases {
+			m.Total++
+			if c.Pass {
+				m.Pass++
+			} else {
+				m.Fail++
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apiserver/pkg/admission/plugin/policy/validating"
+)
+
+func summaryLine(pass bool, policy string, c CaseReport) string {
+	var summary string
+	if pass {
+		summary = "PASS"
+	} else {
+		summary = "FAIL"
+	}
+
+	summary += fmt.Sprintf(": %s", policy)
+	if c.Name != "" {
+		summary += " - " + c.Name
+	}
+	summary += fmt.Sprintf(" - %s ==> %s", strings.ToUpper(string(c.Expect)), resultLabel(c.Result))
+	return summary
+}
+
+// resultLabel returns the result in the human-readable form, e.g. "SETUP ERROR".
+func resultLabel(r Result) string {
+	return strings.ToUpper(strings.ReplaceAll(string(r), "_", " "))
+}
+
+// caseName returns the name of the test case which consists of the operation and the target objects.
+func caseName(testCase TestCase) string {
+	var name string
+	switch operation(testCase) {
+	case "UPDATE":
+		name = fmt.Sprintf("(UPDATE) %s -> %s", testCase.OldObject.String(), testCase.Object.NamespacedName.String())
+	case "CREATE":
+		name = fmt.Sprintf("(CREATE) %s", testCase.Object.String())
+	case "DELETE":
+		name = fmt.Sprintf("(DELETE) %s", testCase.OldObject.String())
+	}
+	if testCase.Param.IsValid() {
+		name += fmt.Sprintf(" (Param: %s)", testCase.Param.String())
+	}
+	if testCase.AdmissionReview != "" {
+		name += fmt.Sprintf(" (AdmissionReview: %s)", testCase.AdmissionReview)
+	}
+	return strings.TrimSpace(name)
+}
+
+// operation returns the admission operation of the test case determined by object and oldObject.
+func operation(testCase TestCase) string {
+	switch {
+	case testCase.Object.IsValid() && testCase.OldObject.IsValid():
+		return "UPDATE"
+	case testCase.Object.IsValid():
+		return "CREATE"
+	case testCase.OldObject.IsValid():
+		return "DELETE"
+	}
+	return ""
+}
+
+// newCaseReport returns CaseReport filled with the fields common to all results.
+func newCaseReport(testCase TestCase, result Result, pass bool) CaseReport {
+	r := CaseReport{
+		Name:      caseName(testCase),
+		Operation: operation(testCase),
+		Expect:    testCase.Expect,
+		Result:    result,
+		Pass:      pass,
+	}
+	if testCase.Object.IsValid() {
+		r.Object = &testCase.Object
+	}
+	if testCase.OldObject.IsValid() {
+		r.OldObject = &testCase.OldObject
+	}
+	if testCase.Param.IsValid() {
+		r.Param = &testCase.Param
+	}
+	return r
+}
+
+func errorStrings(errs []error) []string {
+	out := make([]string, len(errs))
+	for i, err := range errs {
+		out[i] = err.Error()
+	}
+	return out
+}
+
+// newPolicyEvalResult returns the result of the validations and the audit annotations in the policy.
+// validations is the number of spec.validations in the policy.
+func newPolicyEvalResult(tc TestCase, validations int, validateResult validating.ValidateResult) CaseReport {
+	decisions := validateResult.Decisions
+	result := ResultAdmit
+	for _, d := range decisions {
+		if d.Evaluation == validating.EvalDeny {
+			result = ResultDeny
+		} else if d.Evaluation == validating.EvalError {
+			result = ResultError
+			break
+		}
+	}
+
+	out := newCaseReport(tc, result, Result(tc.Expect) == result)
+	for i, d := range decisions {
+		// Workaround to handle the case where the evaluation is not set
+		// TODO remove this workaround after htcps://github.com/kubernetes/kubernetes/pull/126867 is released
+		if d.Evaluation == "" {
+			d.Evaluation = validating.EvalDeny
+		}
+		decision := DecisionReport{
+			Evaluation: Result(d.Evaluation),
+			Reason:     string(d.Reason),
+			Message:    d.Message,
+		}
+		// Each validation makes a decision in order, while an error of the whole policy replaces all of them.
+		if len(decisions) == validations {
+			decision.validation = &i
+		}
+		out.Decisions = append(out.Decisions, decision)
+	}
+	for _, a := range validateResult.AuditAnnotations {
+		// Annotations whose valueExpression is evaluated as null are not published.
+		if a.Action == validating.AuditAnnotationActionExclude {
+			continue
+		}
+		out.AuditAnnotations = append(out.AuditAnnotations, AuditAnnotationReport{
+			Key:   a.Key,
+			Value: a.Value,
+			Error: a.Error,
+		})
+	}
+	return out
+}
+
+// newSetupErrorResult returns the result of the test case which cannot be run, e.g. the object is not found.
+func newSetupErrorResult(tc TestCase, errs []error) CaseReport {
+	out := newCaseReport(tc, ResultSetupError, false)
+	out.Errors = errorStrings(errs)
+	return out
+}
+
+// newPolicyNotMatchConditionResult returns the result of the test case which does not match the matchConditions.
+func newPolicyNotMatchConditionResult(tc TestCase, failedConditionName string) CaseReport {
+	out := newCaseReport(tc, ResultSkip, tc.Expect == Skip)
+	out.FailedMatchCondition = failedConditionName
+	return out
+}
+
+// newPolicyNotMatchedResult returns the result of the test case whose request does not match spec.matchConstraints
+// of the policy in any equivalent version.
+func newPolicyNotMatchedResult(tc TestCase) CaseReport {
+	return newCaseReport(tc, ResultSkip, tc.Expect == Skip)
+}
+
+// newPolicyEvalErrorResult returns the result of the test case whose matchConditions cannot be evaluated.
+func newPolicyEvalErrorResult(tc TestCase, errs []error) CaseReport {
+	out := newCaseReport(tc, ResultError, tc.Expect == Error)
+	out.Errors = errorStrings(errs)
+	return out
+}
+
+// newPolicyEvalFatalErrorResult returns the result of the test case whose validations cannot be run.
+func newPolicyEvalFatalErrorResult(tc TestCase, errs []error) CaseReport {
+	out := newCaseReport(tc, ResultFatalError, false)
+	out.Errors = errorStrings(errs)
+	return out
+}
+
+func newManifestErrorReport(manifestPath string, err error) ManifestReport {
+	return ManifestReport{
+		Path:   manifestPath,
+		Error:  err.Error(),
+		Suites: []SuiteReport{},
+		Total:  1,
+		Fail:   1,
+	}
+}
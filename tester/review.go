@@ -0,0 +1,158 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pfnet/kaptest"
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// readAdmissionRequest reads the request of the admission.k8s.io/v1 AdmissionReview in the YAML or JSON file.
+func readAdmissionRequest(path string) (*admissionv1.AdmissionRequest, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read AdmissionReview: %w", err)
+	}
+	var review admissionv1.AdmissionReview
+	if err := kyaml.NewYAMLOrJSONDecoder(bytes.NewReader(buf), 4096).Decode(&review); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("decode AdmissionReview: %w", err)
+	}
+	if gvk := review.GroupVersionKind(); gvk != admissionv1.SchemeGroupVersion.WithKind("AdmissionReview") {
+		return nil, fmt.Errorf("%s is not admission.k8s.io/v1 AdmissionReview", path)
+	}
+	if review.Request == nil {
+		return nil, fmt.Errorf("AdmissionReview in %s has no request", path)
+	}
+	return review.Request, nil
+}
+
+// withAdmissionRequest returns the test case whose object and oldObject are the ones in the request
+// so that the test case is reported in the same way as the others.
+func (tc TestCase) withAdmissionRequest(req *admissionv1.AdmissionRequest) TestCase {
+	ngvk := NameWithGVK{
+		GVK:            GVK{Group: req.Kind.Group, Version: req.Kind.Version, Kind: req.Kind.Kind},
+		NamespacedName: NamespacedName{Namespace: req.Namespace, Name: req.Name},
+	}
+	if hasRawObject(req.Object) {
+		tc.Object = ngvk
+	}
+	if hasRawObject(req.OldObject) {
+		tc.OldObject = ngvk
+	}
+	return tc
+}
+
+// newReviewValidationParams returns the params to evaluate the policy with the request recorded in an AdmissionReview.
+// The param and the namespace are looked up from the loader in the same way as the other test cases.
+func newReviewValidationParams(vap *v1.ValidatingAdmissionPolicy, tc TestCase, loader *ResourceLoader, req *admissionv1.AdmissionRequest) (kaptest.ValidationParams, []error) {
+	var errs []error
+	obj, err := rawToUnstructured(req.Object)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("decode object: %w", err))
+	}
+	oldObj, err := rawToUnstructured(req.OldObject)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("decode oldObject: %w", err))
+	}
+	options, err := rawToUnstructured(req.Options)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("decode options: %w", err))
+	}
+	paramObj, err := getParamObj(loader, vap, tc.Param)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("get param: %w", err))
+	}
+	namespaceObj, err := getNamespaceObjByName(loader, requestNamespace(loader, schema.GroupKind{Group: req.Kind.Group, Kind: req.Kind.Kind}, req.Namespace))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("get namespace: %w", err))
+	}
+	if len(errs) > 0 {
+		return kaptest.ValidationParams{}, errs
+	}
+
+	extra := make(map[string][]string, len(req.UserInfo.Extra))
+	for k, v := range req.UserInfo.Extra {
+		extra[k] = v
+	}
+	params := kaptest.ValidationParams{
+		ParamObj:     paramObj,
+		NamespaceObj: namespaceObj,
+		UserInfo: &user.DefaultInfo{
+			Name:   req.UserInfo.Username,
+			UID:    req.UserInfo.UID,
+			Groups: req.UserInfo.Groups,
+			Extra:  extra,
+		},
+		Request: &kaptest.RequestAttributes{
+			Operation:   admission.Operation(req.Operation),
+			Kind:        schema.GroupVersionKind(req.Kind),
+			Resource:    schema.GroupVersionResource(req.Resource),
+			SubResource: req.SubResource,
+			Namespace:   req.Namespace,
+			Name:        req.Name,
+			DryRun:      req.DryRun != nil && *req.DryRun,
+		},
+	}
+	// The request was converted to the version of Kind and Resource if RequestKind and RequestResource differ.
+	if req.RequestKind != nil && req.RequestResource != nil {
+		params.Request.Kind = schema.GroupVersionKind(*req.RequestKind)
+		params.Request.Resource = schema.GroupVersionResource(*req.RequestResource)
+		params.Request.VersionedKind = schema.GroupVersionKind(req.Kind)
+		params.Request.VersionedResource = schema.GroupVersionResource(req.Resource)
+	}
+	// Nil objects are left as untyped nil.
+	if obj != nil {
+		params.Object = obj
+	}
+	if oldObj != nil {
+		params.OldObject = oldObj
+	}
+	if options != nil {
+		params.Request.Options = options
+	}
+	return params, nil
+}
+
+// hasRawObject returns whether the raw object is set. An object of a request can be null, e.g. object of DELETE.
+func hasRawObject(raw runtime.RawExtension) bool {
+	return len(raw.Raw) > 0 && !bytes.Equal(bytes.TrimSpace(raw.Raw), []byte("null"))
+}
+
+func rawToUnstructured(raw runtime.RawExtension) (*unstructured.Unstructured, error) {
+	if !hasRawObject(raw) {
+		return nil, nil
+	}
+	var obj map[string]any
+	if err := json.Unmarshal(raw.Raw, &obj); err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: obj}, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	v1 "k8s.io/api/admissionregistration/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestReadAdmissionRequest(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		path      string
+		wantName  string
+		wantError bool
+	}{
+		{
+			name:     "ok: json",
+			path:     "./testdata/vap-with-admission-review.test/create.json",
+			wantName: "ok",
+		},
+		{
+			name:     "ok: yaml",
+			path:     "./testdata/vap-with-admission-review.test/update-scale-down.yaml",
+			wantName: "ok",
+		},
+		{
+			name:      "err: not found",
+			path:      "./testdata/vap-with-admission-review.test/not-exist.json",
+			wantError: true,
+		},
+		{
+			name:      "err: other kind",
+			path:      "./testdata/vap-with-admission-review.test/deployment.yaml",
+			wantError: true,
+		},
+		{
+			name:      "err: v1beta1",
+			path:      "./testdata/vap-with-admission-review.test/v1beta1.yaml",
+			wantError: true,
+		},
+		{
+			name:      "err: no request",
+			path:      "./testdata/vap-with-admission-review.test/no-request.yaml",
+			wantError: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			req, err := readAdmissionRequest(tt.path)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("readAdmissionRequest() error = nil, want error")
+				}
+				return
+			}
+			mustNil(t, err)
+			if req.Name != tt.wantName {
+				t.Errorf("request name = %q, want %q", req.Name, tt.wantName)
+			}
+		})
+	}
+}
+
+func TestNewReviewValidationParams_RequestKind(t *testing.T) {
+	t.Parallel()
+	req := &admissionv1.AdmissionRequest{
+		Kind:            metav1.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+		Resource:        metav1.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"},
+		RequestKind:     &metav1.GroupVersionKind{Group: "apps", Version: "v1beta2", Kind: "Deployment"},
+		RequestResource: &metav1.GroupVersionResource{Group: "apps", Version: "v1beta2", Resource: "deployments"},
+		Operation:       admissionv1.Create,
+		Name:            "d",
+	}
+	params, errs := newReviewValidationParams(&v1.ValidatingAdmissionPolicy{}, TestCase{}, NewResourceLoader(), req)
+	if len(errs) > 0 {
+		t.Fatalf("newReviewValidationParams() errors = %v", errs)
+	}
+	r := params.Request
+	if r.Kind.Version != "v1beta2" || r.Resource.Version != "v1beta2" || r.VersionedKind.Version != "v1" || r.VersionedResource.Version != "v1" {
+		t.Errorf("Request = %+v, want the request in v1beta2 converted to v1", r)
+	}
+}
+
+func TestRunner_AdmissionReviewConflicts(t *testing.T) {
+	t.Parallel()
+	report, err := NewRunner(Options{}).Run([]string{"testdata/vap-with-admission-review.test/invalid-with-review.yaml"})
+	mustNil(t, err)
+	want := []string{
+		"object and oldObject cannot be given with admissionReview",
+		"requestKind cannot be given with admissionReview",
+		"userInfo cannot be given with admissionReview",
+	}
+	cases := report.Manifests[0].Suites[0].Cases
+	if len(cases) != len(want) {
+		t.Fatalf("got %d cases, want %d", len(cases), len(want))
+	}
+	for i, c := range cases {
+		if c.Result != ResultSetupError || len(c.Errors) == 0 || !strings.Contains(c.Errors[0], want[i]) {
+			t.Errorf("case %d: got %+v, want setup error %q", i, c, want[i])
+		}
+	}
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pfnet/kaptest"
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/admission"
+	"k8s.io/apiserver/pkg/authentication/user"
+)
+
+// ErrViolationFound is returned by RunScan when any object violates the policies.
+var ErrViolationFound = errors.New("violation found")
+
+// ScanOptions is the options of RunScan.
+type ScanOptions struct {
+	// Policies is the list of the files, directories or glob patterns of the policies to evaluate.
+	Policies []string
+	// Resources is the list of the files, directories or glob patterns of the bindings, params and namespaces.
+	Resources []string
+	// Dumps is the list of the files, directories or glob patterns of the objects to scan, e.g. `kubectl get -A -o yaml`.
+	Dumps []string
+	// Operation is the operation of the requests, either CREATE or UPDATE. CREATE is used if empty.
+	// The old object of UPDATE is the object itself.
+	Operation string
+	// UserInfo is the user who sends the requests.
+	UserInfo UserInfo
+	// StrictNamespaces makes the objects in Namespaces not in the dumps nor the resources errors,
+	// instead of using Namespaces without labels and annotations.
+	StrictNamespaces bool
+	// Output is the output format, either text or json.
+	Output OutputFormat
+}
+
+// ScanReport is the results of the objects in the dumps evaluated against the policies.
+type ScanReport struct {
+	// Objects is the number of the objects scanned.
+	Objects  int                `json:"objects"`
+	Policies []PolicyScanReport `json:"policies"`
+}
+
+// PolicyScanReport is the results of a policy and a binding of it.
+type PolicyScanReport struct {
+	Policy string `json:"policy"`
+	// Binding is the name of the ValidatingAdmissionPolicyBinding.
+	// It is empty if no binding of the policy is loaded, in which case the policy applies to all the objects it matches.
+	Binding string `json:"binding,omitempty"`
+	// ValidationActions is the actions of the binding on the objects failing the validations.
+	ValidationActions []v1.ValidationAction `json:"validationActions"`
+	// Matched is the number of the objects matching the policy and the binding.
+	Matched int `json:"matched"`
+	Admit   int `json:"admit"`
+	// Deny is the number of the objects denied.
+	// The objects failing the validations of a binding without the Deny action are counted in Warn and Audit instead.
+	Deny  int `json:"deny"`
+	Warn  int `json:"warn"`
+	Audit int `json:"audit"`
+	Error int `json:"error"`
+	Skip  int `json:"skip"`
+	// Violations is the objects denied by the policy or failed to be evaluated.
+	Violations []ScanViolation `json:"violations,omitempty"`
+}
+
+// ScanViolation is an object denied by the policy or failed to be evaluated.
+type ScanViolation struct {
+	Object NameWithGVK `json:"object"`
+	// Result is either deny or error.
+	Result   Result   `json:"result"`
+	Messages []string `json:"messages"`
+}
+
+// RunScan evaluates the policies against the objects in the dumps and writes the results to stdout.
+// It returns ErrViolationFound if any object violates the policies.
+func RunScan(opts ScanOptions) error {
+	if opts.Output == "" {
+		opts.Output = OutputText
+	}
+	if opts.Output != OutputText && opts.Output != OutputJSON {
+		return fmt.Errorf("unsupported output format %q: must be text or json", opts.Output)
+	}
+	report, err := Scan(opts)
+	if err != nil {
+		return err
+	}
+	if opts.Output == OutputJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		writeScanText(os.Stdout, report)
+	}
+	for _, p := range report.Policies {
+		if len(p.Violations) > 0 {
+			return ErrViolationFound
+		}
+	}
+	return nil
+}
+
+// Scan evaluates the policies against each object in the dumps as if it were created or updated.
+// The namespaces, bindings and params are looked up from the dumps in addition to opts.Resources.
+func Scan(opts ScanOptions) (ScanReport, error) {
+	op := admission.Operation(strings.ToUpper(opts.Operation))
+	if op == "" {
+		op = admission.Create
+	}
+	if op != admission.Create && op != admission.Update {
+		return ScanReport{}, fmt.Errorf("unsupported operation %q: must be CREATE or UPDATE", opts.Operation)
+	}
+	if len(opts.Dumps) == 0 {
+		return ScanReport{}, errors.New("no dump is given")
+	}
+
+	loader := NewResourceLoader()
+	loader.StrictNamespaces = opts.StrictNamespaces
+	if err := loader.LoadVaps(opts.Policies); err != nil {
+		return ScanReport{}, fmt.Errorf("load policies: %w", err)
+	}
+	if err := loader.LoadResources(opts.Resources); err != nil {
+		return ScanReport{}, fmt.Errorf("load resources: %w", err)
+	}
+	objects, err := loader.loadResources(opts.Dumps)
+	if err != nil {
+		return ScanReport{}, fmt.Errorf("load dumps: %w", err)
+	}
+	if err := loader.check(); err != nil {
+		return ScanReport{}, fmt.Errorf("load: %w", err)
+	}
+	if len(loader.Vaps) == 0 {
+		return ScanReport{}, errors.New("no ValidatingAdmissionPolicy found")
+	}
+
+	targets, err := newPolicyTargets(loader)
+	if err != nil {
+		return ScanReport{}, err
+	}
+	namespaces := newNamespaceCache(loader)
+	userInfo := NewK8sUserInfo(opts.UserInfo)
+	report := ScanReport{Objects: len(objects), Policies: make([]PolicyScanReport, len(targets))}
+	for i, t := range targets {
+		report.Policies[i] = PolicyScanReport{Policy: t.vap.Name, Binding: t.bindingName(), ValidationActions: t.validationActions()}
+	}
+	for _, obj := range objects {
+		req := newScanRequest(obj, op, &userInfo)
+		namespaceObj, err := namespaces.get(requestNamespace(loader, req.attrs.Kind.GroupKind(), req.attrs.Namespace))
+		// An object rejected by its CustomResourceDefinition cannot be created nor updated.
+		if ierr := loader.invalid[req.tc.Object]; ierr != nil {
+			err = fmt.Errorf("%s: %w", req.tc.Object.String(), ierr)
+		}
+		for i, t := range targets {
+			if err != nil {
+				report.Policies[i].record(req, newSetupErrorResult(req.tc, []error{err}))
+				continue
+			}
+			if c, matched := evalTarget(loader, t, req, namespaceObj); matched {
+				report.Policies[i].record(req, c)
+			}
+		}
+	}
+	return report, nil
+}
+
+// newScanRequest returns the request to create the object, or to update the object to itself.
+func newScanRequest(obj *unstructured.Unstructured, op admission.Operation, userInfo *user.DefaultInfo) *admissionRequest {
+	gvk := obj.GroupVersionKind()
+	// The resource is guessed from the kind since the dumps have no information about it.
+	gvr, _ := meta.UnsafeGuessKindToResource(gvk)
+	req := &admissionRequest{
+		obj: obj,
+		attrs: &kaptest.RequestAttributes{
+			Operation: op,
+			Kind:      gvk,
+			Resource:  gvr,
+			Namespace: obj.GetNamespace(),
+			Name:      obj.GetName(),
+		},
+		userInfo: userInfo,
+		tc:       TestCase{Object: NewNameWithGVKFromObj(obj)},
+	}
+	if op == admission.Update {
+		req.oldObj = obj
+		req.tc.OldObject = req.tc.Object
+	}
+	return req
+}
+
+func (p *PolicyScanReport) record(req *admissionRequest, c CaseReport) {
+	p.Matched++
+	switch c.Result {
+	case ResultAdmit:
+		p.Admit++
+		return
+	case ResultSkip:
+		p.Skip++
+		return
+	case ResultDeny:
+		if !hasAction(p.ValidationActions, v1.Deny) {
+			countNotDenied(p.ValidationActions, &p.Warn, &p.Audit)
+			return
+		}
+		p.Deny++
+	default:
+		p.Error++
+	}
+	v := ScanViolation{Object: req.tc.Object, Result: c.Result}
+	if v.Result != ResultDeny {
+		v.Result = ResultError
+	}
+	for _, d := range c.Decisions {
+		if d.Evaluation == ResultDeny || d.Evaluation == ResultError {
+			v.Messages = append(v.Messages, d.Message)
+		}
+	}
+	v.Messages = append(v.Messages, c.Errors...)
+	p.Violations = append(p.Violations, v)
+}
+
+// writeScanText writes the results of Scan in the human-readable format.
+func writeScanText(w io.Writer, r ScanReport) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Scanned %d objects\n", r.Objects)
+	for _, p := range r.Policies {
+		name := p.Policy
+		if p.Binding != "" {
+			name += " (binding: " + p.Binding + ")"
+		}
+		fmt.Fprintf(&b, "\n%s\n", name)
+		writeMatchedCounts(&b, p.ValidationActions, p.Matched, p.Admit, p.Deny, p.Warn, p.Audit, p.Error, p.Skip)
+		for _, v := range p.Violations {
+			gv := schema.GroupVersion{Group: v.Object.Group, Version: v.Object.Version}
+			fmt.Fprintf(&b, "  %s %s %s\n", resultLabel(v.Result), gv.String(), v.Object.String())
+			for _, m := range v.Messages {
+				fmt.Fprintf(&b, "    %q\n", m)
+			}
+		}
+	}
+	_, _ = io.WriteString(w, b.String())
+}
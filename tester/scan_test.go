@@ -0,0 +1,179 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+)
+
+func TestScan(t *testing.T) {
+	t.Parallel()
+	path := func(name string) string { return filepath.Join("testdata/scan.test", name) }
+	scannedPod := func(namespace string) NameWithGVK {
+		return NameWithGVK{GVK: GVK{Version: "v1", Kind: "Pod"}, NamespacedName: NamespacedName{Namespace: namespace, Name: "scanned"}}
+	}
+
+	deny := []v1.ValidationAction{v1.Deny}
+	violations := []ScanViolation{
+		{
+			Object:   NameWithGVK{GVK: GVK{Group: "apps", Version: "v1", Kind: "Deployment"}, NamespacedName: NamespacedName{Namespace: "foo", Name: "bad"}},
+			Result:   ResultDeny,
+			Messages: []string{"replicas must be equal or less than 5"},
+		},
+		{
+			Object:   NameWithGVK{GVK: GVK{Group: "apps", Version: "v1", Kind: "Deployment"}, NamespacedName: NamespacedName{Namespace: "foo", Name: "typed"}},
+			Result:   ResultDeny,
+			Messages: []string{"replicas must be equal or less than 5"},
+		},
+	}
+	tests := []struct {
+		name    string
+		opts    ScanOptions
+		want    ScanReport
+		wantErr bool
+	}{
+		{
+			name: "ok: create",
+			opts: ScanOptions{Policies: []string{"testdata/replay.test/policy.yaml"}, Resources: []string{path("resources.yaml")}, Dumps: []string{path("dump.yaml")}},
+			want: ScanReport{Objects: 6, Policies: []PolicyScanReport{
+				{Policy: "deployment-replicas", Binding: "prod", ValidationActions: deny, Matched: 3, Admit: 1, Deny: 2, Violations: violations},
+			}},
+		},
+		{
+			name: "ok: update",
+			opts: ScanOptions{Policies: []string{"testdata/replay.test/policy.yaml"}, Resources: []string{path("resources.yaml")}, Dumps: []string{path("dump*.yaml")}, Operation: "update"},
+			want: ScanReport{Objects: 6, Policies: []PolicyScanReport{
+				{Policy: "deployment-replicas", Binding: "prod", ValidationActions: deny, Matched: 3, Admit: 1, Deny: 2, Violations: violations},
+			}},
+		},
+		{
+			name: "ok: custom resources are processed with the CustomResourceDefinition",
+			opts: ScanOptions{
+				Policies:  []string{"testdata/vap-with-crds.yaml"},
+				Resources: []string{"testdata/vap-with-crds.test/crd.yaml"},
+				Dumps:     []string{"testdata/vap-with-crds.test/resources.yaml", "testdata/vap-with-crds.test/widgets/invalid-required.yaml"},
+			},
+			want: ScanReport{Objects: 3, Policies: []PolicyScanReport{
+				{Policy: "widget-color", ValidationActions: deny, Matched: 3, Admit: 1, Error: 2, Violations: []ScanViolation{
+					{
+						Object:   NameWithGVK{GVK: GVK{Group: "example.com", Version: "v1", Kind: "Widget"}, NamespacedName: NamespacedName{Namespace: "default", Name: "invalid"}},
+						Result:   ResultError,
+						Messages: []string{"Widget:default/invalid: invalid Widget: spec.size in body should be greater than or equal to 1"},
+					},
+					{
+						Object:   NameWithGVK{GVK: GVK{Group: "example.com", Version: "v1", Kind: "Widget"}, NamespacedName: NamespacedName{Namespace: "default", Name: "w"}},
+						Result:   ResultError,
+						Messages: []string{"Widget:default/w: invalid Widget: spec.size in body is required"},
+					},
+				}},
+			}},
+		},
+		{
+			name: "ok: namespace object",
+			opts: ScanOptions{
+				Policies:  []string{"testdata/vap-with-namespace-object.yaml"},
+				Resources: []string{"testdata/vap-with-namespace-object.test/resources.yaml"},
+				Dumps:     []string{"testdata/vap-with-namespace-object.test/dump.yaml"},
+			},
+			want: ScanReport{Objects: 3, Policies: []PolicyScanReport{
+				{Policy: "namespace-object", ValidationActions: deny, Matched: 3, Admit: 1, Deny: 2, Violations: []ScanViolation{
+					{Object: scannedPod("prod"), Result: ResultDeny, Messages: []string{"namespace: prod"}},
+					{Object: scannedPod("missing"), Result: ResultDeny, Messages: []string{"namespace: missing"}},
+				}},
+			}},
+		},
+		{
+			name: "ok: a missing namespace is an error in the strict mode",
+			opts: ScanOptions{
+				Policies:         []string{"testdata/vap-with-namespace-object.yaml"},
+				Resources:        []string{"testdata/vap-with-namespace-object.test/resources.yaml"},
+				Dumps:            []string{"testdata/vap-with-namespace-object.test/dump.yaml"},
+				StrictNamespaces: true,
+			},
+			want: ScanReport{Objects: 3, Policies: []PolicyScanReport{
+				{Policy: "namespace-object", ValidationActions: deny, Matched: 3, Admit: 1, Deny: 1, Error: 1, Violations: []ScanViolation{
+					{Object: scannedPod("prod"), Result: ResultDeny, Messages: []string{"namespace: prod"}},
+					{Object: scannedPod("missing"), Result: ResultError, Messages: []string{`namespace "missing" not found in the resources`}},
+				}},
+			}},
+		},
+		{
+			name: "ok: the objects failing a binding without Deny are not violations",
+			opts: ScanOptions{Policies: []string{"testdata/replay.test/policy.yaml"}, Resources: []string{"testdata/replay.test/resources-warn.yaml"}, Dumps: []string{path("dump.yaml")}},
+			want: ScanReport{Objects: 6, Policies: []PolicyScanReport{
+				{Policy: "deployment-replicas", Binding: "deployment-replicas-warn", ValidationActions: []v1.ValidationAction{v1.Warn, v1.Audit}, Matched: 3, Admit: 1, Warn: 2, Audit: 2},
+			}},
+		},
+		{
+			name:    "err: unsupported operation",
+			opts:    ScanOptions{Policies: []string{"testdata/replay.test/policy.yaml"}, Dumps: []string{path("dump.yaml")}, Operation: "DELETE"},
+			wantErr: true,
+		},
+		{
+			name:    "err: no dump",
+			opts:    ScanOptions{Policies: []string{"testdata/replay.test/policy.yaml"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := Scan(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Scan() error = nil, want error")
+				}
+				return
+			}
+			mustNil(t, err)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Scan() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteScanText(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	writeScanText(&buf, ScanReport{Objects: 2, Policies: []PolicyScanReport{{
+		Policy:  "deployment-replicas",
+		Matched: 2,
+		Admit:   1,
+		Deny:    1,
+		Violations: []ScanViolation{{
+			Object:   NameWithGVK{GVK: GVK{Group: "apps", Version: "v1", Kind: "Deployment"}, NamespacedName: NamespacedName{Namespace: "foo", Name: "bad"}},
+			Result:   ResultDeny,
+			Messages: []string{"too many"},
+		}},
+	}}})
+	want := `Scanned 2 objects
+
+deployment-replicas
+  matched 2: admit 1, deny 1, error 0, skip 0
+  DENY apps/v1 Deployment:foo/bad
+    "too many"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("writeScanText() = %q, want %q", got, want)
+	}
+}
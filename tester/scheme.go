@@ -0,0 +1,151 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/api/admissionregistration/v1alpha1"
+	"k8s.io/api/admissionregistration/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer/json"
+)
+
+// policyScheme has the versions of ValidatingAdmissionPolicy and ValidatingAdmissionPolicyBinding
+// with the conversions from v1alpha1 and v1beta1 to v1, which the tester evaluates.
+var policyScheme = newPolicyScheme()
+
+// policyVersions is the supported versions of ValidatingAdmissionPolicy and ValidatingAdmissionPolicyBinding.
+var policyVersions = []schema.GroupVersion{v1.SchemeGroupVersion, v1beta1.SchemeGroupVersion, v1alpha1.SchemeGroupVersion}
+
+// strictPolicyDecoder reports the fields unknown to the declared version as strict decoding errors.
+var strictPolicyDecoder = json.NewSerializerWithOptions(json.DefaultMetaFactory, policyScheme, policyScheme,
+	json.SerializerOptions{Strict: true})
+
+func newPolicyScheme() *runtime.Scheme {
+	s := runtime.NewScheme()
+	for _, add := range []func(*runtime.Scheme) error{v1.AddToScheme, v1beta1.AddToScheme, v1alpha1.AddToScheme} {
+		if err := add(s); err != nil {
+			panic(err)
+		}
+	}
+	// The older versions are converted through the unstructured representation,
+	// which fails on a field missing in v1 instead of dropping it. See TestPolicyScheme_FieldCompatibility.
+	for _, pair := range []struct{ from, to any }{
+		{(*v1beta1.ValidatingAdmissionPolicy)(nil), (*v1.ValidatingAdmissionPolicy)(nil)},
+		{(*v1alpha1.ValidatingAdmissionPolicy)(nil), (*v1.ValidatingAdmissionPolicy)(nil)},
+		{(*v1beta1.ValidatingAdmissionPolicyBinding)(nil), (*v1.ValidatingAdmissionPolicyBinding)(nil)},
+		{(*v1alpha1.ValidatingAdmissionPolicyBinding)(nil), (*v1.ValidatingAdmissionPolicyBinding)(nil)},
+	} {
+		if err := s.AddConversionFunc(pair.from, pair.to, convertSameShape); err != nil {
+			panic(err)
+		}
+	}
+	return s
+}
+
+func convertSameShape(in, out any, _ conversion.Scope) error {
+	u, err := runtime.DefaultUnstructuredConverter.ToUnstructured(in)
+	if err != nil {
+		return err
+	}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructuredWithValidation(u, out, true); err != nil {
+		return err
+	}
+	// The declared version is replaced with v1 as the API server does.
+	out.(runtime.Object).GetObjectKind().SetGroupVersionKind(v1.SchemeGroupVersion.WithKind(
+		in.(runtime.Object).GetObjectKind().GroupVersionKind().Kind))
+	return nil
+}
+
+// isPolicyVersion returns whether the group version is one of policyVersions.
+func isPolicyVersion(gv schema.GroupVersion) bool {
+	for _, v := range policyVersions {
+		if v == gv {
+			return true
+		}
+	}
+	return false
+}
+
+// decodePolicyObject decodes the document of a policy or a binding in its declared version.
+// The fields unknown to the version are dropped and returned as warnings.
+func decodePolicyObject(doc []byte, apiVersion string) (runtime.Object, []string, error) {
+	obj, _, err := strictPolicyDecoder.Decode(doc, nil, nil)
+	if err == nil {
+		return obj, nil, nil
+	}
+	strictErr, ok := runtime.AsStrictDecodingError(err)
+	if !ok || obj == nil {
+		return nil, nil, err
+	}
+	var warnings []string
+	for _, e := range strictErr.Errors() {
+		if field, ok := strings.CutPrefix(e.Error(), "unknown field "); ok {
+			warnings = append(warnings, fmt.Sprintf("field %s is not available in %s and is ignored", field, apiVersion))
+		} else {
+			warnings = append(warnings, e.Error())
+		}
+	}
+	return obj, warnings, nil
+}
+
+// toV1Policy converts a ValidatingAdmissionPolicy of any supported version to v1.
+func toV1Policy(obj runtime.Object) (*v1.ValidatingAdmissionPolicy, error) {
+	if vap, ok := obj.(*v1.ValidatingAdmissionPolicy); ok {
+		return vap, nil
+	}
+	var vap v1.ValidatingAdmissionPolicy
+	if err := policyScheme.Convert(obj, &vap, nil); err != nil {
+		return nil, fmt.Errorf("convert to %s: %w", v1.SchemeGroupVersion, err)
+	}
+	return &vap, nil
+}
+
+// toV1Binding converts a loaded ValidatingAdmissionPolicyBinding of any supported version to v1.
+// The fields unknown to the declared version are dropped and returned as warnings as decodePolicyObject.
+func toV1Binding(obj *unstructured.Unstructured) (*v1.ValidatingAdmissionPolicyBinding, []string, error) {
+	if !isPolicyVersion(obj.GroupVersionKind().GroupVersion()) {
+		return nil, nil, fmt.Errorf("unsupported apiVersion %q: must be one of %v", obj.GetAPIVersion(), policyVersions)
+	}
+	doc, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, nil, err
+	}
+	typed, warnings, err := decodePolicyObject(doc, obj.GetAPIVersion())
+	if err != nil {
+		return nil, nil, err
+	}
+	if b, ok := typed.(*v1.ValidatingAdmissionPolicyBinding); ok {
+		return b, warnings, nil
+	}
+	var b v1.ValidatingAdmissionPolicyBinding
+	if err := policyScheme.Convert(typed, &b, nil); err != nil {
+		return nil, nil, fmt.Errorf("convert to %s: %w", v1.SchemeGroupVersion, err)
+	}
+	return &b, warnings, nil
+}
+
+// isBinding returns whether the kind is ValidatingAdmissionPolicyBinding of any version.
+func isBinding(gvk schema.GroupVersionKind) bool {
+	return gvk.Group == v1.GroupName && gvk.Kind == "ValidatingAdmissionPolicyBinding"
+}
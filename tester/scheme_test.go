@@ -0,0 +1,92 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/admissionregistration/v1"
+	"k8s.io/api/admissionregistration/v1alpha1"
+	"k8s.io/api/admissionregistration/v1beta1"
+)
+
+// TestPolicyScheme_FieldCompatibility checks that every field of the older versions exists in v1 with the same type,
+// which convertSameShape relies on.
+func TestPolicyScheme_FieldCompatibility(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		from, to any
+	}{
+		{name: "ok: v1beta1 ValidatingAdmissionPolicy", from: v1beta1.ValidatingAdmissionPolicy{}, to: v1.ValidatingAdmissionPolicy{}},
+		{name: "ok: v1alpha1 ValidatingAdmissionPolicy", from: v1alpha1.ValidatingAdmissionPolicy{}, to: v1.ValidatingAdmissionPolicy{}},
+		{name: "ok: v1beta1 ValidatingAdmissionPolicyBinding", from: v1beta1.ValidatingAdmissionPolicyBinding{}, to: v1.ValidatingAdmissionPolicyBinding{}},
+		{name: "ok: v1alpha1 ValidatingAdmissionPolicyBinding", from: v1alpha1.ValidatingAdmissionPolicyBinding{}, to: v1.ValidatingAdmissionPolicyBinding{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			from := jsonFields(reflect.TypeOf(tt.from), "", map[reflect.Type]bool{})
+			to := jsonFields(reflect.TypeOf(tt.to), "", map[reflect.Type]bool{})
+			for path, kind := range from {
+				if to[path] != kind {
+					t.Errorf("field %s (%s) is not in v1 (%s)", path, kind, to[path])
+				}
+			}
+		})
+	}
+}
+
+// jsonFields returns the kinds of the JSON fields of the type keyed by their paths.
+func jsonFields(typ reflect.Type, prefix string, seen map[reflect.Type]bool) map[string]reflect.Kind {
+	fields := map[string]reflect.Kind{}
+	for typ.Kind() == reflect.Pointer || typ.Kind() == reflect.Slice || typ.Kind() == reflect.Map {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || seen[typ] {
+		return fields
+	}
+	seen[typ] = true
+	defer delete(seen, typ)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		path := prefix
+		if !f.Anonymous || name != "" {
+			path += "." + name
+			fields[path] = f.Type.Kind()
+		}
+		for p, k := range jsonFields(f.Type, path, seen) {
+			fields[p] = k
+		}
+	}
+	return fields
+}
+
+func TestToV1Binding_Unsupported(t *testing.T) {
+	t.Parallel()
+	loader := NewResourceLoader()
+	mustNil(t, loader.LoadResources([]string{"testdata/load-versions.test/unsupported-binding.yaml"}))
+	if len(loader.Issues) != 1 || !strings.Contains(loader.Issues[0].Message, `unsupported apiVersion "admissionregistration.k8s.io/v2"`) {
+		t.Errorf("Issues = %v, want the unsupported apiVersion", loader.Issues)
+	}
+}
@@ -0,0 +1,269 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// snapshotHeader is written at the top of the snapshot files.
+const snapshotHeader = "# Generated by kaptest run --update-snapshots. DO NOT EDIT.\n"
+
+// snapshotFile is the content of the snapshot file of a test manifest.
+type snapshotFile struct {
+	Snapshots []caseSnapshot `yaml:"snapshots"`
+}
+
+// caseSnapshot is the results of a test case recorded in the snapshot file.
+// Durations and positions are excluded since they change without the changes of the policies.
+type caseSnapshot struct {
+	Policy               string               `yaml:"policy"`
+	Name                 string               `yaml:"name"`
+	Result               Result               `yaml:"result"`
+	Decisions            []decisionSnapshot   `yaml:"decisions,omitempty"`
+	AuditAnnotations     []annotationSnapshot `yaml:"auditAnnotations,omitempty"`
+	Warnings             []string             `yaml:"warnings,omitempty"`
+	FailedMatchCondition string               `yaml:"failedMatchCondition,omitempty"`
+	Errors               []string             `yaml:"errors,omitempty"`
+}
+
+type decisionSnapshot struct {
+	Evaluation Result `yaml:"evaluation"`
+	Reason     string `yaml:"reason,omitempty"`
+	Message    string `yaml:"message,omitempty"`
+}
+
+type annotationSnapshot struct {
+	Key   string `yaml:"key"`
+	Value string `yaml:"value,omitempty"`
+	Error string `yaml:"error,omitempty"`
+}
+
+// snapshotPath returns the path of the snapshot file of the manifest, e.g. "kaptest.snapshot.yaml" for "kaptest.yaml".
+func snapshotPath(manifestPath string) string {
+	ext := filepath.Ext(manifestPath)
+	return strings.TrimSuffix(manifestPath, ext) + ".snapshot" + ext
+}
+
+func newCaseSnapshot(policy string, c CaseReport) caseSnapshot {
+	s := caseSnapshot{
+		Policy:               policy,
+		Name:                 c.Name,
+		Result:               c.Result,
+		Warnings:             c.Warnings,
+		FailedMatchCondition: c.FailedMatchCondition,
+		Errors:               c.Errors,
+	}
+	for _, d := range c.Decisions {
+		s.Decisions = append(s.Decisions, decisionSnapshot{Evaluation: d.Evaluation, Reason: d.Reason, Message: d.Message})
+	}
+	for _, a := range c.AuditAnnotations {
+		s.AuditAnnotations = append(s.AuditAnnotations, annotationSnapshot(a))
+	}
+	return s
+}
+
+// key returns the key to find the snapshot of the test case.
+// The index distinguishes the test cases with the same name, e.g. the ones with different userInfo.
+func (s caseSnapshot) key(index int) string {
+	return fmt.Sprintf("%s\x00%s\x00%d", s.Policy, s.Name, index)
+}
+
+// keyedSnapshot is a snapshot with its key.
+type keyedSnapshot struct {
+	key      string
+	snapshot caseSnapshot
+}
+
+// keySnapshots returns the snapshots with the keys in the order of the given snapshots.
+func keySnapshots(snapshots []caseSnapshot) []keyedSnapshot {
+	seen := map[string]int{}
+	out := make([]keyedSnapshot, len(snapshots))
+	for i, s := range snapshots {
+		name := s.Policy + "\x00" + s.Name
+		out[i] = keyedSnapshot{key: s.key(seen[name]), snapshot: s}
+		seen[name]++
+	}
+	return out
+}
+
+// checkSnapshots compares the results of the test cases opting into the snapshot with the snapshot file of the manifest,
+// and sets SnapshotMismatch and Pass of them. The snapshot file is rewritten with the results instead if update is true.
+// If the snapshot file cannot be read or written, all the test cases opting into the snapshot fail with the error.
+// suites must be the results of manifests.TestSuites in the same order.
+func checkSnapshots(manifestPath string, manifests TestManifests, suites []SuiteReport, update bool) {
+	var cases []*CaseReport
+	var snapshots []caseSnapshot
+	for i, tt := range manifests.TestSuites {
+		if i >= len(suites) {
+			break
+		}
+		for j, tc := range tt.Tests {
+			if !tc.Snapshot || j >= len(suites[i].Cases) {
+				continue
+			}
+			c := &suites[i].Cases[j]
+			// The decision is asserted only by the snapshot when expect is omitted.
+			if c.Expect == "" {
+				c.Pass = c.Result != ResultSetupError && c.Result != ResultFatalError
+			}
+			cases = append(cases, c)
+			snapshots = append(snapshots, newCaseSnapshot(tt.Policy, *c))
+		}
+	}
+
+	if err := compareSnapshots(snapshotPath(manifestPath), cases, snapshots, update); err != nil {
+		for _, c := range cases {
+			c.SnapshotMismatch = err.Error()
+			c.Pass = false
+		}
+	}
+}
+
+// compareSnapshots compares the snapshots of the test cases with the snapshot file, or writes them to it if update is true.
+func compareSnapshots(path string, cases []*CaseReport, snapshots []caseSnapshot, update bool) error {
+	if update {
+		return writeSnapshotFile(path, snapshots)
+	}
+	if len(cases) == 0 {
+		return nil
+	}
+
+	recorded, err := readSnapshotFile(path)
+	if err != nil {
+		return err
+	}
+	byKey := map[string]caseSnapshot{}
+	for _, s := range keySnapshots(recorded) {
+		byKey[s.key] = s.snapshot
+	}
+	for i, s := range keySnapshots(snapshots) {
+		c := cases[i]
+		want, ok := byKey[s.key]
+		if !ok {
+			c.SnapshotMismatch = "snapshot is not recorded; run with --update-snapshots to record it"
+			c.Pass = false
+			continue
+		}
+		wantYAML, gotYAML := marshalSnapshot(want), marshalSnapshot(s.snapshot)
+		if wantYAML != gotYAML {
+			c.SnapshotMismatch = "results do not match the snapshot (-snapshot +result)\n" + diffLines(wantYAML, gotYAML)
+			c.Pass = false
+		}
+	}
+	return nil
+}
+
+func marshalSnapshot(s caseSnapshot) string {
+	b, _ := yaml.Marshal(s)
+	return string(b)
+}
+
+// readSnapshotFile reads the snapshots in the file. It returns no snapshot if the file does not exist.
+func readSnapshotFile(path string) ([]caseSnapshot, error) {
+	buf, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot file: %w", err)
+	}
+	var f snapshotFile
+	if err := yaml.Unmarshal(buf, &f); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot file %q: %w", path, err)
+	}
+	return f.Snapshots, nil
+}
+
+// writeSnapshotFile writes the snapshots to the file if they are changed.
+// The file is removed if there is no snapshot.
+func writeSnapshotFile(path string, snapshots []caseSnapshot) error {
+	current, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("read snapshot file: %w", err)
+	}
+	exists := err == nil
+	if len(snapshots) == 0 {
+		if !exists {
+			return nil
+		}
+		slog.Info("remove snapshot file", "path", path)
+		return os.Remove(path)
+	}
+
+	b, err := yaml.Marshal(snapshotFile{Snapshots: snapshots})
+	if err != nil {
+		return fmt.Errorf("marshal snapshots: %w", err)
+	}
+	buf := append([]byte(snapshotHeader), b...)
+	if exists && bytes.Equal(current, buf) {
+		return nil
+	}
+	slog.Info("update snapshot file", "path", path)
+	if err := os.WriteFile(path, buf, 0o644); err != nil {
+		return fmt.Errorf("write snapshot file: %w", err)
+	}
+	return nil
+}
+
+// diffLines returns the line-based difference between a and b.
+// Removed lines are prefixed with "-", added ones with "+", and the common ones with " ".
+func diffLines(a, b string) string {
+	x := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	y := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	// lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:].
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			out = append(out, " "+x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+x[i])
+			i++
+		default:
+			out = append(out, "+"+y[j])
+			j++
+		}
+	}
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunner_Snapshots(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	copyTestdata(t, dir,
+		"vap-with-snapshots.yaml",
+		"vap-with-snapshots.test/kaptest.yaml",
+		"vap-with-snapshots.test/resources.yaml",
+	)
+	manifestPath := filepath.Join(dir, "vap-with-snapshots.test/kaptest.yaml")
+	snapshotPath := filepath.Join(dir, "vap-with-snapshots.test/kaptest.snapshot.yaml")
+	run := func(update bool) ManifestReport {
+		t.Helper()
+		report, err := NewRunner(Options{UpdateSnapshots: update}).Run([]string{manifestPath})
+		mustNil(t, err)
+		return report.Manifests[0]
+	}
+
+	// The snapshot is not recorded yet.
+	m := run(false)
+	if m.Pass != 1 || m.Fail != 2 {
+		t.Fatalf("pass = %d, fail = %d, want 1, 2", m.Pass, m.Fail)
+	}
+	if got := m.Suites[0].Cases[0].SnapshotMismatch; !strings.Contains(got, "not recorded") {
+		t.Errorf("SnapshotMismatch = %q, want not recorded", got)
+	}
+
+	m = run(true)
+	if m.Fail != 0 {
+		t.Fatalf("fail = %d on update, want 0", m.Fail)
+	}
+	got, err := os.ReadFile(snapshotPath)
+	mustNil(t, err)
+	want, err := os.ReadFile("testdata/vap-with-snapshots.test/kaptest.snapshot.yaml")
+	mustNil(t, err)
+	if string(got) != string(want) {
+		t.Errorf("snapshot file = %q, want %q", got, want)
+	}
+
+	m = run(false)
+	if m.Fail != 0 {
+		t.Errorf("fail = %d with the recorded snapshot, want 0", m.Fail)
+	}
+
+	// Changing only the warnings fails the test case as well.
+	resourcesPath := filepath.Join(dir, "vap-with-snapshots.test/resources.yaml")
+	touch(t, resourcesPath, strings.NewReplacer("name: deployment-replicas-warn", "name: deployment-replicas-warning"))
+	m = run(false)
+	if m.Pass != 2 || m.Fail != 1 {
+		t.Fatalf("pass = %d, fail = %d with the warnings changed, want 2, 1", m.Pass, m.Fail)
+	}
+	if got := m.Suites[0].Cases[1].SnapshotMismatch; !strings.Contains(got, "+  ''deployment-replicas-warning''") {
+		t.Errorf("SnapshotMismatch = %q, want to contain the changed warning", got)
+	}
+	touch(t, resourcesPath, strings.NewReplacer("name: deployment-replicas-warning", "name: deployment-replicas-warn"))
+
+	// Changing only the message fails the test case even though the decision is expected.
+	touch(t, filepath.Join(dir, "vap-with-snapshots.yaml"), strings.NewReplacer("or less than 5", "or less than five"))
+	m = run(false)
+	if m.Pass != 2 || m.Fail != 1 {
+		t.Fatalf("pass = %d, fail = %d, want 2, 1", m.Pass, m.Fail)
+	}
+	c := m.Suites[0].Cases[1]
+	if c.Result != ResultDeny || c.Pass {
+		t.Errorf("result = %s, pass = %t, want deny, false", c.Result, c.Pass)
+	}
+	for _, s := range []string{
+		"-  message: replicas must be equal or less than 5",
+		"+  message: replicas must be equal or less than five",
+	} {
+		if !strings.Contains(c.SnapshotMismatch, s) {
+			t.Errorf("SnapshotMismatch = %q, want to contain %q", c.SnapshotMismatch, s)
+		}
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{name: "ok: same", a: "a\nb\n", b: "a\nb\n", want: " a\n b"},
+		{name: "ok: changed", a: "a\nb\nc\n", b: "a\nx\nc\n", want: " a\n-b\n+x\n c"},
+		{name: "ok: added and removed", a: "a\nb\n", b: "b\nc\n", want: "-a\n b\n+c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := diffLines(tt.a, tt.b); got != tt.want {
+				t.Errorf("diffLines() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunner_InvalidSnapshotFile(t *testing.T) {
+	t.Parallel()
+	report, err := NewRunner(Options{}).Run([]string{"testdata/vap-with-snapshots.test/invalid-snapshot.yaml"})
+	mustNil(t, err)
+	m := report.Manifests[0]
+	// Only the test cases opting into the snapshot fail, and the others keep their results.
+	if m.Error != "" || m.Pass != 1 || m.Fail != 2 {
+		t.Fatalf("error = %q, pass = %d, fail = %d, want no error, 1, 2", m.Error, m.Pass, m.Fail)
+	}
+	for i, c := range m.Suites[0].Cases[:2] {
+		if c.Pass || !strings.Contains(c.SnapshotMismatch, "unmarshal snapshot file") {
+			t.Errorf("case %d: pass = %t, SnapshotMismatch = %q, want the error of the snapshot file", i, c.Pass, c.SnapshotMismatch)
+		}
+	}
+	if c := m.Suites[0].Cases[2]; !c.Pass || c.Result != ResultAdmit {
+		t.Errorf("case 2: pass = %t, result = %s, want true, admit", c.Pass, c.Result)
+	}
+}
@@ -0,0 +1,492 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tester runs the tests of ValidatingAdmissionPolicy defined in test manifests.
+// Runner returns the results as Report, and the kaptest command renders it in the output formats.
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pfnet/kaptest"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var ErrTestFail = errors.New("test failed")
+
+// Run runs the test cases defined in multiple manifest files and writes the results in cfg.Outputs.
+// Directories in pathList are searched recursively for test manifests.
+func Run(cfg CmdConfig, pathList []string) error {
+	outputs, err := openOutputs(cfg.Outputs)
+	if err != nil {
+		return err
+	}
+	defer outputs.close()
+
+	runner := NewRunner(Options{
+		ManifestPattern:  cfg.ManifestPattern,
+		Ignore:           cfg.Ignore,
+		Parallelism:      cfg.Parallelism,
+		ChangedSince:     cfg.ChangedSince,
+		UpdateSnapshots:  cfg.UpdateSnapshots,
+		WarningsAsErrors: cfg.WarningsAsErrors,
+		ApplyDefaults:    cfg.ApplyDefaults,
+		ValidateFixtures: cfg.ValidateFixtures,
+		StrictNamespaces: cfg.StrictNamespaces,
+		OnManifest: func(m ManifestReport) {
+			outputs.writeManifest(m, cfg.Verbose)
+		},
+	})
+	report, err := runner.Run(pathList)
+	if err != nil {
+		return err
+	}
+	if cfg.ChangedSince != "" && len(report.Manifests) == 0 {
+		slog.Info("no test manifest is affected by the changes", "since", cfg.ChangedSince)
+	}
+	if err := outputs.writeReport(report); err != nil {
+		return fmt.Errorf("write report: %w", err)
+	}
+
+	fail := report.Fail
+	if cfg.Update {
+		fixed, skipped, err := updateManifests(outputs.messageWriter(), report)
+		if err != nil {
+			return err
+		}
+		// The test cases which could not be updated or also fail otherwise still fail.
+		fail -= fixed
+		if skipped > 0 {
+			return ErrTestFail
+		}
+	}
+	if fail > 0 {
+		return ErrTestFail
+	}
+	return nil
+}
+
+// Options is the options of Runner.
+type Options struct {
+	// ManifestPattern is the glob pattern of test manifests discovered in directories.
+	// It is matched against the path of each file relative to the searched directory.
+	// DefaultManifestPattern is used if empty.
+	ManifestPattern string
+	// Ignore is the list of glob patterns of files and directories skipped in the discovery.
+	// They are matched against the paths relative to the searched directory.
+	Ignore []string
+	// Parallelism is the maximum number of manifests and test cases run concurrently.
+	// They are run one by one if it is less than 2.
+	Parallelism int
+	// ChangedSince is the git ref to run only the manifests affected by the files changed since it.
+	// All the manifests are run if empty. See AffectedManifests.
+	ChangedSince string
+	// UpdateSnapshots rewrites the snapshot files with the results of the test cases instead of comparing them.
+	UpdateSnapshots bool
+	// WarningsAsErrors makes the tests in a manifest fail when loading its policies and resources has warnings,
+	// e.g. duplicate definitions.
+	WarningsAsErrors bool
+	// ApplyDefaults applies the defaults of the API server to the built-in objects in the resources
+	// before they are evaluated. See ResourceLoader.ApplyDefaults.
+	ApplyDefaults bool
+	// ValidateFixtures makes the test cases using the built-in objects invalid against the Kubernetes API fail
+	// with setup errors. See ResourceLoader.ValidateFixtures.
+	ValidateFixtures bool
+	// StrictNamespaces makes the test cases fail with setup errors when the Namespace of the object is not in the resources,
+	// instead of using a Namespace without labels and annotations. See ResourceLoader.StrictNamespaces.
+	StrictNamespaces bool
+	// OnManifest is called with the results of each manifest in the order of the manifests.
+	// It is called as soon as the manifest and all the preceding ones finish.
+	OnManifest func(ManifestReport)
+}
+
+// Runner runs the test cases defined in test manifests and returns the results as Report.
+// It is safe for concurrent use since it does not change the working directory.
+type Runner struct {
+	opts Options
+	// caseSlots limits the number of test cases run concurrently.
+	caseSlots chan struct{}
+	// validators is shared by all the manifests so that each policy is compiled once.
+	validators *kaptest.ValidatorCache
+}
+
+// NewRunner returns a new Runner.
+func NewRunner(opts Options) *Runner {
+	r := &Runner{opts: opts, validators: kaptest.NewValidatorCache()}
+	r.caseSlots = make(chan struct{}, r.parallelism())
+	return r
+}
+
+func (r *Runner) parallelism() int {
+	if r.opts.Parallelism < 1 {
+		return 1
+	}
+	return r.opts.Parallelism
+}
+
+// Run runs the test cases defined in multiple manifest files.
+// Directories in paths are searched recursively for test manifests.
+// Failures of the test cases are reported in Report, and an error is returned only when
+// the manifests cannot be resolved.
+func (r *Runner) Run(paths []string) (Report, error) {
+	manifestPaths, roots, err := resolveManifests(r.opts, paths)
+	if err != nil {
+		return Report{}, err
+	}
+	// Policies tested by the manifests which are not run are not reported as untested.
+	allManifestPaths := manifestPaths
+	if r.opts.ChangedSince != "" {
+		manifestPaths, err = AffectedManifests(manifestPaths, r.opts.ChangedSince)
+		if err != nil {
+			return Report{}, fmt.Errorf("find affected manifests: %w", err)
+		}
+	}
+
+	start := time.Now()
+	manifests := make([]ManifestReport, len(manifestPaths))
+	done := make([]chan struct{}, len(manifestPaths))
+	slots := make(chan struct{}, r.parallelism())
+	for i, path := range manifestPaths {
+		done[i] = make(chan struct{})
+		go func() {
+			defer close(done[i])
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			manifests[i] = r.RunManifest(path)
+		}()
+	}
+	// Notify the results in the order of the manifests regardless of the order they finish.
+	for i := range manifestPaths {
+		<-done[i]
+		if r.opts.OnManifest != nil {
+			r.opts.OnManifest(manifests[i])
+		}
+	}
+
+	var untested []UntestedPolicy
+	if len(roots) > 0 {
+		untested, err = findUntestedPolicies(r.opts, roots, allManifestPaths)
+		if err != nil {
+			return Report{}, fmt.Errorf("find untested policies: %w", err)
+		}
+	}
+	return newReport(manifests, untested, time.Since(start)), nil
+}
+
+// RunManifest runs the test cases defined in a single manifest file.
+func (r *Runner) RunManifest(manifestPath string) ManifestReport {
+	start := time.Now()
+	m := r.runManifest(manifestPath)
+	m.Duration = time.Since(start).Seconds()
+	return m
+}
+
+func (r *Runner) runManifest(manifestPath string) ManifestReport {
+	// Read manifest yaml
+	manifestFile, err := os.ReadFile(manifestPath)
+	if err != nil {
+		return newManifestErrorReport(manifestPath, fmt.Errorf("read manifest YAML: %w", err))
+	}
+
+	var manifests TestManifests
+	if err := yaml.Unmarshal(manifestFile, &manifests); err != nil {
+		return newManifestErrorReport(manifestPath, fmt.Errorf("unmarshal manifest YAML: %w", err))
+	}
+	if ok, msg := manifests.IsValid(); !ok {
+		return newManifestErrorReport(manifestPath, fmt.Errorf("invalid manifest: %v", msg))
+	}
+
+	// Load validatingAdmissionPolicies and other resources relative to the manifest
+	baseDir := filepath.Dir(manifestPath)
+	loader := NewResourceLoader()
+	loader.StrictNamespaces = r.opts.StrictNamespaces
+	if err := loader.LoadVaps(resolvePaths(baseDir, manifests.ValidatingAdmissionPolicies)); err != nil {
+		return newManifestErrorReport(manifestPath, fmt.Errorf("load validatingAdmissionPolicies: %w", err))
+	}
+	if err := loader.LoadResources(resolvePaths(baseDir, manifests.Resources)); err != nil {
+		return newManifestErrorReport(manifestPath, fmt.Errorf("load resources: %w", err))
+	}
+	// The fixtures are validated before the defaulting drops the unknown fields.
+	if r.opts.ValidateFixtures {
+		loader.ValidateFixtures()
+	}
+	if r.opts.ApplyDefaults {
+		loader.ApplyDefaults()
+	}
+	if err := loader.Err(r.opts.WarningsAsErrors); err != nil {
+		report := newManifestErrorReport(manifestPath, fmt.Errorf("load policies and resources: %w", err))
+		report.LoadIssues = loader.Issues
+		return report
+	}
+
+	bindings, err := loadedBindings(loader)
+	if err != nil {
+		return newManifestErrorReport(manifestPath, fmt.Errorf("load resources: %w", err))
+	}
+
+	positions := parseManifestPositions(manifestPath, manifestFile)
+	report := ManifestReport{
+		Path:       manifestPath,
+		LoadIssues: loader.Issues,
+		Suites:     make([]SuiteReport, 0, len(manifests.TestSuites)),
+	}
+
+	// Run test cases concurrently up to the parallelism
+	var wg sync.WaitGroup
+	for i, tt := range manifests.TestSuites {
+		suite := SuiteReport{
+			Policy:   tt.Policy,
+			Position: positions.suite(i),
+			Cases:    []CaseReport{},
+		}
+
+		// Create Validator
+		vap, ok := loader.Vaps[tt.Policy]
+		if !ok {
+			suite.Error = "policy not found"
+			report.Suites = append(report.Suites, suite)
+			continue
+		}
+		validator := r.validators.Get(vap)
+
+		suite.Cases = make([]CaseReport, len(tt.Tests))
+		for j, tc := range tt.Tests {
+			r.caseSlots <- struct{}{}
+			wg.Add(1)
+			go func() {
+				defer func() {
+					<-r.caseSlots
+					wg.Done()
+				}()
+				start := time.Now()
+				c := runTestCase(vap, validator, tt.Policy, bindings[tt.Policy], tc, loader, baseDir)
+				c.Duration = time.Since(start).Seconds()
+				c.Position = positions.testCase(i, j)
+				loader.vapPositions[tt.Policy].annotate(&c)
+				suite.Cases[j] = c
+			}()
+		}
+		report.Suites = append(report.Suites, suite)
+	}
+	wg.Wait()
+	checkSnapshots(manifestPath, manifests, report.Suites, r.opts.UpdateSnapshots)
+	report.count()
+
+	return report
+}
+
+// runTestCase runs a single test case against the policy. baseDir is the directory to resolve the paths in the test case.
+// The bindings of the policy are used only to report the warnings of the test case.
+func runTestCase(vap *v1.ValidatingAdmissionPolicy, validator kaptest.ValidatorInterface, policy string, bindings []*v1.ValidatingAdmissionPolicyBinding, tc TestCase, loader *ResourceLoader, baseDir string) CaseReport {
+	slog.Debug("SETUP: ", "policy", policy, "expect", tc.Expect, "object", tc.Object.String(), "oldObject", tc.OldObject.String(), "param", tc.Param.String())
+
+	// Setup params for validation
+	var given kaptest.ValidationParams
+	var errs []error
+	if tc.AdmissionReview != "" {
+		if tc.Object.IsValid() || tc.OldObject.IsValid() {
+			return newSetupErrorResult(tc, []error{errors.New("object and oldObject cannot be given with admissionReview")})
+		}
+		if tc.RequestKind != (GVK{}) {
+			return newSetupErrorResult(tc, []error{errors.New("requestKind cannot be given with admissionReview")})
+		}
+		if tc.UserInfo.Name != "" || len(tc.UserInfo.Groups) > 0 || len(tc.UserInfo.Extra) > 0 {
+			return newSetupErrorResult(tc, []error{errors.New("userInfo cannot be given with admissionReview")})
+		}
+		req, err := readAdmissionRequest(resolvePaths(baseDir, []string{tc.AdmissionReview})[0])
+		if err != nil {
+			return newSetupErrorResult(tc, []error{err})
+		}
+		tc = tc.withAdmissionRequest(req)
+		given, errs = newReviewValidationParams(vap, tc, loader, req)
+	} else {
+		given, errs = newValidationParams(vap, tc, loader)
+	}
+	if len(errs) > 0 {
+		return newSetupErrorResult(tc, errs)
+	}
+	if tc.RequestKind != (GVK{}) {
+		matched, err := applyRequestKind(vap, tc, loader, &given)
+		if err != nil {
+			return newSetupErrorResult(tc, []error{err})
+		}
+		if !matched {
+			return newPolicyNotMatchedResult(tc)
+		}
+	}
+	slog.Debug("RUN:   ", "policy", policy, "expect", tc.Expect, "object", tc.Object.String(), "oldObject", tc.OldObject.String(), "param", tc.Param.String())
+	c := evalPolicy(vap, validator, tc, given)
+	warnings, err := bindingWarnings(vap, bindings, given, c)
+	if err != nil {
+		return newSetupErrorResult(tc, []error{err})
+	}
+	c.Warnings = warnings
+	return c
+}
+
+// evalPolicy evaluates the matchConditions and the validations of the policy with the given params.
+func evalPolicy(vap *v1.ValidatingAdmissionPolicy, validator kaptest.ValidatorInterface, tc TestCase, given kaptest.ValidationParams) CaseReport {
+	// Run EvalMatchConditions
+	if vap.Spec.MatchConditions != nil {
+		matchResult := validator.EvalMatchCondition(given)
+		if matchResult.Error != nil {
+			return newPolicyEvalErrorResult(tc, []error{matchResult.Error})
+		}
+		if !matchResult.Matches {
+			return newPolicyNotMatchConditionResult(tc, matchResult.FailedConditionName)
+		}
+	}
+	// Run validation
+	validationResult, err := validator.Validate(given)
+	if err != nil {
+		return newPolicyEvalFatalErrorResult(tc, []error{err})
+	}
+
+	return newPolicyEvalResult(tc, len(vap.Spec.Validations), *validationResult)
+}
+
+func newValidationParams(vap *v1.ValidatingAdmissionPolicy, tc TestCase, loader *ResourceLoader) (kaptest.ValidationParams, []error) {
+	var errs []error
+	var err error
+	var obj, oldObj *unstructured.Unstructured
+	if !tc.Object.IsValid() && !tc.OldObject.IsValid() {
+		errs = append(errs, fmt.Errorf("object or oldObject must be given and valid"))
+	} else {
+		if obj, err = loader.GetResource(tc.Object); err != nil {
+			errs = append(errs, fmt.Errorf("get object: %w", err))
+		}
+		if oldObj, err = loader.GetResource(tc.OldObject); err != nil {
+			errs = append(errs, fmt.Errorf("get oldObject: %w", err))
+		}
+		if obj == nil && oldObj == nil {
+			errs = append(errs, fmt.Errorf("neither object nor oldObject found"))
+		}
+	}
+
+	var paramObj *unstructured.Unstructured
+	if paramObj, err = getParamObj(loader, vap, tc.Param); err != nil {
+		errs = append(errs, fmt.Errorf("get param: %w", err))
+	}
+
+	var namespaceObj *corev1.Namespace
+	if namespaceObj, err = getNamespaceObj(loader, obj, oldObj); err != nil {
+		errs = append(errs, fmt.Errorf("get namespace: %w", err))
+	}
+
+	userInfo := NewK8sUserInfo(tc.UserInfo)
+
+	if len(errs) > 0 {
+		return kaptest.ValidationParams{}, errs
+	}
+
+	return kaptest.ValidationParams{
+		Object:       obj,
+		OldObject:    oldObj,
+		ParamObj:     paramObj,
+		NamespaceObj: namespaceObj,
+		UserInfo:     &userInfo,
+	}, nil
+}
+
+func getParamObj(loader *ResourceLoader, vap *v1.ValidatingAdmissionPolicy, param NamespacedName) (*unstructured.Unstructured, error) {
+	if vap.Spec.ParamKind == nil {
+		return nil, nil
+	}
+	if param.Name == "" {
+		return nil, fmt.Errorf("param name is empty")
+	}
+
+	paramNGVK := NewNameWithGVK(schema.FromAPIVersionAndKind(vap.Spec.ParamKind.APIVersion, vap.Spec.ParamKind.Kind), param)
+	paramObj, err := loader.GetResource(paramNGVK)
+	if err != nil {
+		return nil, fmt.Errorf("get param: %w", err)
+	}
+	if paramObj == nil {
+		return nil, fmt.Errorf("param not found")
+	}
+	return paramObj, nil
+}
+
+func getNamespaceObj(loader *ResourceLoader, obj, oldObj *unstructured.Unstructured) (*corev1.Namespace, error) {
+	if obj == nil && oldObj == nil {
+		return nil, fmt.Errorf("neither object nor oldObject found")
+	}
+	src := obj
+	if src == nil {
+		src = oldObj
+	}
+	namespaceName, err := getNamespaceName(obj, oldObj)
+	if err != nil {
+		return nil, fmt.Errorf("extract namespace: %w", err)
+	}
+	return getNamespaceObjByName(loader, requestNamespace(loader, src.GroupVersionKind().GroupKind(), namespaceName))
+}
+
+// getNamespaceObjByName returns the Namespace of the name from the loader, and nil if the name is empty.
+// A Namespace without labels and annotations is returned if not found unless loader.StrictNamespaces is set.
+func getNamespaceObjByName(loader *ResourceLoader, namespaceName string) (*corev1.Namespace, error) {
+	if namespaceName == "" {
+		return nil, nil
+	}
+
+	namespaceNGVK := NewNameWithGVK(schema.FromAPIVersionAndKind("v1", "Namespace"), NamespacedName{Name: namespaceName})
+	uNamespaceObj, err := loader.GetResource(namespaceNGVK)
+	if err != nil {
+		return nil, fmt.Errorf("get namespace: %w", err)
+	}
+	if uNamespaceObj == nil {
+		if loader.StrictNamespaces {
+			return nil, fmt.Errorf("namespace %q not found in the resources", namespaceName)
+		}
+		slog.Info("use default namespace with no labels and annotations", "namespace", namespaceName)
+		return &corev1.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: namespaceName,
+			},
+		}, nil
+	}
+
+	var namespaceObj corev1.Namespace
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(uNamespaceObj.Object, &namespaceObj); err != nil {
+		return nil, fmt.Errorf("convert to namespace: %w", err)
+	}
+	return &namespaceObj, nil
+}
+
+func getNamespaceName(obj, oldObj *unstructured.Unstructured) (string, error) {
+	if oldObj == nil {
+		return obj.GetNamespace(), nil
+	}
+	if obj == nil {
+		return oldObj.GetNamespace(), nil
+	}
+	if obj.GetNamespace() != oldObj.GetNamespace() {
+		return "", errors.New("namespace is different between object and oldObject")
+	}
+	return obj.GetNamespace(), nil
+}
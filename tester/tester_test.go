@@ -0,0 +1,217 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr error
+	}{
+		{
+			name: "ok",
+			args: []string{
+				"./testdata/vap-standard-resources.test/kaptest.yaml",
+				"./testdata/vap-custom-resources.test/kaptest.yaml",
+				"./testdata/vap-with-params.test/kaptest.yaml",
+				"./testdata/vap-with-namespaces.test/kaptest.yaml",
+				"./testdata/vap-with-userinfo.test/kaptest.yaml",
+				"./testdata/vap-with-admission-review.test/kaptest.yaml",
+			},
+			wantErr: nil,
+		},
+		{
+			name:    "ok: discover test manifests recursively",
+			args:    []string{"./testdata/..."},
+			wantErr: nil,
+		},
+		{
+			name:    "err: file not found",
+			args:    []string{"./testdata/not-found.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: unmarshal error",
+			args:    []string{"./testdata/invalid-format.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: invalid config",
+			args:    []string{"./testdata/invalid-config.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: policy file not found",
+			args:    []string{"./testdata/invalid-policy-file-not-found.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: policy not exist",
+			args:    []string{"./testdata/vap-standard-resources.test/invalid-no-policy.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: object not exist",
+			args:    []string{"./testdata/vap-standard-resources.test/invalid-no-obj.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: object not exist (custom resource)",
+			args:    []string{"./testdata/vap-custom-resources.test/invalid-no-obj.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: params not exist",
+			args:    []string{"./testdata/vap-with-params.test/invalid-no-params.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: namespace not exist",
+			args:    []string{"./testdata/vap-with-namespaces.test/invalid-no-namespace.yaml"},
+			wantErr: ErrTestFail,
+		},
+		{
+			name:    "err: admissionReview not exist",
+			args:    []string{"./testdata/vap-with-admission-review.test/invalid-no-review.yaml"},
+			wantErr: ErrTestFail,
+		},
+	}
+	for _, tt := range tests {
+		cfg := CmdConfig{Verbose: true}
+		t.Run(tt.name, func(t *testing.T) {
+			got := Run(cfg, tt.args)
+			if got != tt.wantErr {
+				t.Errorf("Run() = %v, want %v", got, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRunner(t *testing.T) {
+	t.Parallel()
+	var notified []string
+	runner := NewRunner(Options{
+		OnManifest: func(m ManifestReport) {
+			notified = append(notified, m.Path)
+		},
+	})
+	report, err := runner.Run([]string{
+		"./testdata/vap-standard-resources.test/kaptest.yaml",
+		"./testdata/vap-standard-resources.test/invalid-no-obj.yaml",
+	})
+	mustNil(t, err)
+	if len(notified) != 2 || len(report.Manifests) != 2 {
+		t.Fatalf("unexpected manifests: notified %v, report %+v", notified, report.Manifests)
+	}
+	if report.Total != 13 || report.Pass != 12 || report.Fail != 1 {
+		t.Errorf("unexpected summary: total %d, pass %d, fail %d", report.Total, report.Pass, report.Fail)
+	}
+
+	suite := report.Manifests[0].Suites[0]
+	if suite.Policy != "deployment-replicas" || len(suite.Cases) != 4 {
+		t.Fatalf("unexpected suite: %+v", suite)
+	}
+	got := suite.Cases[1]
+	if got.Name != "(CREATE) Deployment:bad" || got.Expect != Deny || got.Result != ResultDeny || !got.Pass {
+		t.Errorf("unexpected case: %+v", got)
+	}
+	if len(got.Decisions) != 1 || got.Decisions[0].Evaluation != ResultDeny {
+		t.Errorf("unexpected decisions: %+v", got.Decisions)
+	}
+
+	got = report.Manifests[1].Suites[0].Cases[0]
+	if got.Result != ResultSetupError || got.Pass || len(got.Errors) == 0 {
+		t.Errorf("unexpected case: %+v", got)
+	}
+
+	if _, err := runner.Run([]string{"./testdata/not-found/..."}); err == nil {
+		t.Errorf("Run() error = nil, want error")
+	}
+}
+
+func TestRunner_Parallel(t *testing.T) {
+	t.Parallel()
+	run := func(parallelism int) ([]string, Report) {
+		var notified []string
+		runner := NewRunner(Options{
+			Parallelism: parallelism,
+			OnManifest: func(m ManifestReport) {
+				notified = append(notified, m.Path)
+			},
+		})
+		report, err := runner.Run([]string{"./testdata/..."})
+		mustNil(t, err)
+		// Durations vary between runs.
+		report.Duration = 0
+		for i := range report.Manifests {
+			m := &report.Manifests[i]
+			m.Duration = 0
+			for j := range m.Suites {
+				for k := range m.Suites[j].Cases {
+					m.Suites[j].Cases[k].Duration = 0
+				}
+			}
+		}
+		return notified, report
+	}
+
+	wantNotified, want := run(1)
+	gotNotified, got := run(8)
+	if !reflect.DeepEqual(gotNotified, wantNotified) {
+		t.Errorf("OnManifest is called in %v, want %v", gotNotified, wantNotified)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() with parallelism = %+v, want %+v", got, want)
+	}
+}
+
+func TestRunner_LoadIssues(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name             string
+		manifest         string
+		warningsAsErrors bool
+		wantFail         bool
+		wantIssue        LoadIssueSeverity
+	}{
+		{name: "ok: duplicate resource is a warning", manifest: "duplicate.yaml", wantIssue: LoadIssueWarning},
+		{name: "err: warnings as errors", manifest: "duplicate.yaml", warningsAsErrors: true, wantFail: true, wantIssue: LoadIssueWarning},
+		{name: "err: invalid resource", manifest: "invalid.yaml", wantFail: true, wantIssue: LoadIssueError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			runner := NewRunner(Options{WarningsAsErrors: tt.warningsAsErrors})
+			report, err := runner.Run([]string{filepath.Join("testdata/load-issues.test", tt.manifest)})
+			mustNil(t, err)
+			m := report.Manifests[0]
+			if (m.Fail > 0) != tt.wantFail || (m.Error != "") != tt.wantFail {
+				t.Errorf("unexpected result: fail %d, error %q", m.Fail, m.Error)
+			}
+			if len(m.LoadIssues) != 1 || m.LoadIssues[0].Severity != tt.wantIssue {
+				t.Errorf("unexpected load issues: %+v", m.LoadIssues)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// expectChange is an update of the expect field of a test case.
+type expectChange struct {
+	position *Position
+	policy   string
+	name     string
+	from     PolicyDecisionExpect
+	to       PolicyDecisionExpect
+	// fixed is true if the expectation is the only failure of the test case,
+	// i.e. the test case passes after the update.
+	fixed bool
+}
+
+// manifestEdit is a replacement of the text at a position in a manifest.
+type manifestEdit struct {
+	line   int
+	column int
+	// length is the number of characters replaced.
+	length int
+	text   string
+}
+
+// updateManifests updates the expectations of the failed test cases in the manifests of the report,
+// writes the summary to w and returns the numbers of the test cases fixed by the update and the ones which could not be updated.
+// An updated test case is not fixed if it also fails otherwise, e.g. by a snapshot mismatch.
+func updateManifests(w io.Writer, report Report) (fixed, skipped int, err error) {
+	changes := make(map[string][]expectChange)
+	skips := make(map[string][]expectChange)
+	paths := make([]string, 0, len(report.Manifests))
+	defer func() { writeExpectChanges(w, changes, skips, paths) }()
+	for _, m := range report.Manifests {
+		cs, ss, err := updateManifest(m)
+		if err != nil {
+			return fixed, skipped, fmt.Errorf("update %s: %w", m.Path, err)
+		}
+		changes[m.Path] = cs
+		skips[m.Path] = ss
+		paths = append(paths, m.Path)
+		for _, c := range cs {
+			if c.fixed {
+				fixed++
+			}
+		}
+		skipped += len(ss)
+	}
+	return fixed, skipped, nil
+}
+
+// updateManifest rewrites the expect fields of the failed test cases in the manifest to their results.
+// Only the values are replaced in place so that the comments, ordering and formatting are kept.
+// Test cases whose results cannot be expected, e.g. setup errors, are left as they are.
+// Test cases which cannot be edited in place, e.g. in the flow style or with a multi-line expect, are returned as skipped.
+// NOTE: Only decisions are updated since the manifest has no message assertions yet.
+func updateManifest(m ManifestReport) (changes, skipped []expectChange, err error) {
+	if m.Error != "" {
+		return nil, nil, nil
+	}
+	buf, err := os.ReadFile(m.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("read manifest: %w", err)
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(buf, &doc); err != nil || len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("parse manifest: %w", err)
+	}
+	suites := mappingValue(doc.Content[0], "testSuites")
+	if suites == nil || suites.Kind != yamlv3.SequenceNode {
+		return nil, nil, fmt.Errorf("testSuites is not found")
+	}
+
+	var edits []manifestEdit
+	for i, s := range m.Suites {
+		var tests *yamlv3.Node
+		if i < len(suites.Content) {
+			tests = mappingValue(suites.Content[i], "tests")
+		}
+		for j, c := range s.Cases {
+			if c.Pass {
+				continue
+			}
+			to, ok := expectOf(c.Result)
+			if !ok || to == c.Expect {
+				continue
+			}
+			// The decision of the test case without expect is asserted by the snapshot.
+			if c.Expect == "" && c.SnapshotMismatch != "" {
+				continue
+			}
+			change := expectChange{position: c.Position, policy: s.Policy, name: c.Name, from: c.Expect, to: to, fixed: c.SnapshotMismatch == ""}
+			edit, ok := caseEdit(tests, j, to)
+			if !ok {
+				skipped = append(skipped, change)
+				continue
+			}
+			edits = append(edits, edit)
+			changes = append(changes, change)
+		}
+	}
+	if len(edits) == 0 {
+		return nil, skipped, nil
+	}
+
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stat manifest: %w", err)
+	}
+	if err := os.WriteFile(m.Path, applyEdits(buf, edits), info.Mode().Perm()); err != nil {
+		return nil, nil, fmt.Errorf("write manifest: %w", err)
+	}
+	return changes, skipped, nil
+}
+
+// caseEdit returns the edit to set the expect field of the j-th test case in the tests node.
+// It returns false if the test case is not a block mapping.
+func caseEdit(tests *yamlv3.Node, j int, to PolicyDecisionExpect) (manifestEdit, bool) {
+	if tests == nil || tests.Kind != yamlv3.SequenceNode || j >= len(tests.Content) {
+		return manifestEdit{}, false
+	}
+	tc := tests.Content[j]
+	if tc.Kind != yamlv3.MappingNode || tc.Style&yamlv3.FlowStyle != 0 {
+		return manifestEdit{}, false
+	}
+	return expectEdit(tc, to)
+}
+
+// expectOf returns the expectation matching the result of a test case.
+func expectOf(r Result) (PolicyDecisionExpect, bool) {
+	switch r {
+	case ResultAdmit:
+		return Admit, true
+	case ResultDeny:
+		return Deny, true
+	case ResultError:
+		return Error, true
+	case ResultSkip:
+		return Skip, true
+	}
+	return "", false
+}
+
+// expectEdit returns the edit to set the expect field of the test case.
+// The field is added before the first field of the test case if missing.
+func expectEdit(tc *yamlv3.Node, to PolicyDecisionExpect) (manifestEdit, bool) {
+	v := mappingValue(tc, "expect")
+	if v == nil {
+		if len(tc.Content) == 0 {
+			return manifestEdit{}, false
+		}
+		first := tc.Content[0]
+		return manifestEdit{
+			line:   first.Line,
+			column: first.Column,
+			text:   fmt.Sprintf("expect: %s\n%s", to, strings.Repeat(" ", first.Column-1)),
+		}, true
+	}
+	if v.Kind != yamlv3.ScalarNode || strings.Contains(v.Value, "\n") {
+		return manifestEdit{}, false
+	}
+	length := len([]rune(v.Value))
+	if v.Style&(yamlv3.DoubleQuotedStyle|yamlv3.SingleQuotedStyle) != 0 {
+		length += 2
+	}
+	return manifestEdit{line: v.Line, column: v.Column, length: length, text: string(to)}, true
+}
+
+// applyEdits applies the edits to buf. The positions of the edits must not overlap.
+func applyEdits(buf []byte, edits []manifestEdit) []byte {
+	lines := bytes.SplitAfter(buf, []byte("\n"))
+	// Apply the edits from the end so that the positions of the preceding ones are kept.
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line > edits[j].line
+		}
+		return edits[i].column > edits[j].column
+	})
+	for _, e := range edits {
+		if e.line < 1 || e.line > len(lines) {
+			continue
+		}
+		content, eol := string(lines[e.line-1]), ""
+		if trimmed := strings.TrimRight(content, "\r\n"); trimmed != content {
+			content, eol = trimmed, content[len(trimmed):]
+		}
+		line := []rune(content)
+		start := e.column - 1
+		end := start + e.length
+		if start < 0 || end > len(line) {
+			continue
+		}
+		lines[e.line-1] = []byte(string(line[:start]) + e.text + string(line[end:]) + eol)
+	}
+	return bytes.Join(lines, nil)
+}
+
+// writeExpectChanges writes the summary of the updated expectations and the ones which could not be updated.
+func writeExpectChanges(w io.Writer, changes, skipped map[string][]expectChange, manifests []string) {
+	var b strings.Builder
+	if n := writeChangeList(&b, "Updated expectations:", changes, manifests); n > 0 {
+		fmt.Fprintf(&b, "Updated %d test case(s). Review the changes before committing them.\n", n)
+	}
+	if n := writeChangeList(&b, "Expectations not updated:", skipped, manifests); n > 0 {
+		fmt.Fprintf(&b, "Could not update %d test case(s). Rewrite them in the block style with a single-line expect, or update them by hand.\n", n)
+	}
+	_, _ = io.WriteString(w, b.String())
+}
+
+// writeChangeList writes the changes grouped by manifest under the title, and returns the number of them.
+func writeChangeList(b *strings.Builder, title string, changes map[string][]expectChange, manifests []string) int {
+	n := 0
+	for _, m := range manifests {
+		cs := changes[m]
+		if len(cs) == 0 {
+			continue
+		}
+		if n == 0 {
+			b.WriteString("--------------------------------------------------\n")
+			b.WriteString(title + "\n")
+		}
+		fmt.Fprintf(b, "[%s]\n", m)
+		for _, c := range cs {
+			location := ""
+			if c.position != nil {
+				location = fmt.Sprintf(" (line %d)", c.position.Line)
+			}
+			from := strings.ToUpper(string(c.from))
+			if from == "" {
+				from = "NONE"
+			}
+			fmt.Fprintf(b, "%s - %s%s: %s -> %s\n", c.policy, c.name, location, from, strings.ToUpper(string(c.to)))
+		}
+		n += len(cs)
+	}
+	return n
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateManifests(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	copyTestdata(t, dir,
+		"vap-with-namespaces.yaml",
+		"vap-with-namespaces.test/resources.yaml",
+		"vap-with-namespaces.test/invalid-update.yaml",
+	)
+	manifestPath := filepath.Join(dir, "vap-with-namespaces.test", "invalid-update.yaml")
+
+	report, err := NewRunner(Options{}).Run([]string{manifestPath})
+	mustNil(t, err)
+	var out bytes.Buffer
+	fixed, skipped, err := updateManifests(&out, report)
+	mustNil(t, err)
+	if fixed != 2 || skipped != 1 {
+		t.Errorf("updateManifests() = %d, %d, want 2, 1", fixed, skipped)
+	}
+
+	buf, err := os.ReadFile(manifestPath)
+	mustNil(t, err)
+	want := `validatingAdmissionPolicies:
+- ../vap-with-namespaces.yaml
+resources:
+- resources.yaml
+testSuites:
+- policy: deployment-replicas
+  tests:
+  # within the limit
+  - object:
+      kind: Deployment
+      name: ok
+      namespace: foo
+    expect: admit # wrong
+  - expect: deny
+    object:
+      kind: Deployment
+      name: bad
+      namespace: foo
+  - object:
+      kind: Deployment
+      name: bad
+      namespace: foo
+    expect: deny
+  - object:
+      kind: Deployment
+      name: not-found
+      namespace: foo
+    expect: admit
+  - {object: {kind: Deployment, name: bad, namespace: foo}, expect: admit}
+- policy: not-found
+  tests:
+  - object:
+      kind: Deployment
+      name: ok
+    expect: admit
+`
+	if got := string(buf); got != want {
+		t.Errorf("updated manifest = %q, want %q", got, want)
+	}
+	for _, s := range []string{"Deployment:foo/ok (line 9): DENY -> ADMIT", "Deployment:foo/bad (line 14): NONE -> DENY", "Updated 2 test case(s)",
+		"Deployment:foo/bad (line 28): ADMIT -> DENY", "Could not update 1 test case(s)"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("summary %q does not contain %q", out.String(), s)
+		}
+	}
+
+	// The updated manifest passes except the test cases which cannot be expected.
+	report, err = NewRunner(Options{}).Run([]string{manifestPath})
+	mustNil(t, err)
+	if report.Pass != 3 || report.Fail != 3 {
+		t.Errorf("pass = %d, fail = %d, want 3, 3", report.Pass, report.Fail)
+	}
+	fixed, skipped, err = updateManifests(&out, report)
+	mustNil(t, err)
+	if fixed != 0 || skipped != 1 {
+		t.Errorf("updateManifests() = %d, %d, want 0, 1", fixed, skipped)
+	}
+}
+
+func TestUpdateManifests_SnapshotMismatch(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	copyTestdata(t, dir,
+		"vap-with-snapshots.yaml",
+		"vap-with-snapshots.test/kaptest.yaml",
+		"vap-with-snapshots.test/kaptest.snapshot.yaml",
+		"vap-with-snapshots.test/resources.yaml",
+	)
+	manifestPath := filepath.Join(dir, "vap-with-snapshots.test", "kaptest.yaml")
+	// The test case fails both the expectation and the snapshot.
+	touch(t, manifestPath, strings.NewReplacer("expect: deny", "expect: admit"))
+	touch(t, filepath.Join(dir, "vap-with-snapshots.test", "kaptest.snapshot.yaml"), strings.NewReplacer("replicas: 6", "replicas: 7"))
+
+	report, err := NewRunner(Options{}).Run([]string{manifestPath})
+	mustNil(t, err)
+	var out bytes.Buffer
+	fixed, skipped, err := updateManifests(&out, report)
+	mustNil(t, err)
+	if fixed != 0 || skipped != 0 {
+		t.Errorf("updateManifests() = %d, %d, want 0, 0", fixed, skipped)
+	}
+	if !strings.Contains(out.String(), "Deployment:bad (line 12): ADMIT -> DENY") {
+		t.Errorf("summary %q does not contain the updated test case", out.String())
+	}
+
+	report, err = NewRunner(Options{}).Run([]string{manifestPath})
+	mustNil(t, err)
+	if report.Fail != 1 {
+		t.Errorf("fail = %d, want 1", report.Fail)
+	}
+}
+
+func TestApplyEdits(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		buf   string
+		edits []manifestEdit
+		want  string
+	}{
+		{
+			name:  "ok: replace",
+			buf:   "a: admit\nb: 'deny'\n",
+			edits: []manifestEdit{{line: 1, column: 4, length: 5, text: "deny"}, {line: 2, column: 4, length: 6, text: "admit"}},
+			want:  "a: deny\nb: admit\n",
+		},
+		{
+			name:  "ok: insert and replace on the same line",
+			buf:   "- a: x\n",
+			edits: []manifestEdit{{line: 1, column: 3, text: "b: y\n  "}, {line: 1, column: 6, length: 1, text: "z"}},
+			want:  "- b: y\n  a: z\n",
+		},
+		{
+			name:  "ok: multibyte characters",
+			buf:   "# ほげ\na: \"ほげ\"\n",
+			edits: []manifestEdit{{line: 2, column: 4, length: 4, text: "deny"}},
+			want:  "# ほげ\na: deny\n",
+		},
+		{
+			name:  "ok: out of range",
+			buf:   "a: b\n",
+			edits: []manifestEdit{{line: 3, column: 1, length: 1, text: "c"}, {line: 1, column: 4, length: 2, text: "c"}},
+			want:  "a: b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := string(applyEdits([]byte(tt.buf), tt.edits)); got != tt.want {
+				t.Errorf("applyEdits() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"strings"
+	"time"
+)
+
+// DefaultWatchInterval is the default interval to check the changes of the files in the watch mode.
+const DefaultWatchInterval = time.Second
+
+// Watch runs the tests, and then re-runs the manifests affected by the changes of the files until ctx is done.
+// The files of a manifest are the manifest itself and the policy and resource files it loads.
+// Changes are detected by polling the modification time and the size of the files.
+func Watch(ctx context.Context, cfg CmdConfig, pathList []string) error {
+	for _, spec := range cfg.Outputs {
+		if format, _, _ := strings.Cut(spec, "="); format != string(OutputText) {
+			return fmt.Errorf("output format %q is not supported in the watch mode", format)
+		}
+	}
+	// The watch mode selects the affected manifests by itself.
+	if cfg.ChangedSince != "" {
+		return errors.New("--changed-since cannot be used in the watch mode")
+	}
+	interval := cfg.WatchInterval
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	w := newWatcher(cfg, pathList, os.Stdout)
+	if err := w.poll(); err != nil {
+		return err
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.poll(); err != nil {
+				fmt.Fprintf(w.out, "ERROR: %v\n", err)
+			}
+		}
+	}
+}
+
+// watcher keeps the files and the last results of the manifests to re-run only the affected ones.
+type watcher struct {
+	runner  *Runner
+	opts    Options
+	paths   []string
+	out     io.Writer
+	verbose bool
+
+	// manifests is the manifests in the order to be reported.
+	manifests []string
+	// stamps is the states of the files of each manifest when it is run last.
+	stamps map[string]map[string]fileStamp
+	// results is the last results of each manifest.
+	results map[string]ManifestReport
+}
+
+// fileStamp is the state of a file used to detect its changes.
+type fileStamp struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func newWatcher(cfg CmdConfig, paths []string, out io.Writer) *watcher {
+	w := &watcher{
+		opts: Options{
+			ManifestPattern:  cfg.ManifestPattern,
+			Ignore:           cfg.Ignore,
+			Parallelism:      cfg.Parallelism,
+			WarningsAsErrors: cfg.WarningsAsErrors,
+			ApplyDefaults:    cfg.ApplyDefaults,
+			ValidateFixtures: cfg.ValidateFixtures,
+			StrictNamespaces: cfg.StrictNamespaces,
+		},
+		paths:   paths,
+		out:     out,
+		verbose: cfg.Verbose,
+		stamps:  map[string]map[string]fileStamp{},
+		results: map[string]ManifestReport{},
+	}
+	opts := w.opts
+	opts.OnManifest = w.report
+	w.runner = NewRunner(opts)
+	return w
+}
+
+// poll runs the manifests which are new or whose files have changed since the last run.
+func (w *watcher) poll() error {
+	manifests, _, err := resolveManifests(w.opts, w.paths)
+	if err != nil {
+		return err
+	}
+
+	var affected []string
+	current := map[string]struct{}{}
+	for _, m := range manifests {
+		current[m] = struct{}{}
+		stamps := statFiles(manifestFiles(m))
+		if prev, ok := w.stamps[m]; ok && maps.Equal(prev, stamps) {
+			continue
+		}
+		w.stamps[m] = stamps
+		affected = append(affected, m)
+	}
+	var removed []string
+	for _, m := range w.manifests {
+		if _, ok := current[m]; !ok {
+			removed = append(removed, m)
+			delete(w.stamps, m)
+			delete(w.results, m)
+		}
+	}
+	w.manifests = manifests
+	if len(affected) == 0 && len(removed) == 0 {
+		return nil
+	}
+
+	if len(w.results) > 0 || len(removed) > 0 {
+		fmt.Fprintln(w.out, "--------------------------------------------------")
+		fmt.Fprintf(w.out, "[%s] %d manifest(s) changed\n\n", time.Now().Format(time.TimeOnly), len(affected)+len(removed))
+	}
+	for _, m := range removed {
+		fmt.Fprintf(w.out, "[%s]\nREMOVED\n\n", m)
+	}
+	if len(affected) > 0 {
+		if _, err := w.runner.Run(affected); err != nil {
+			return err
+		}
+	}
+
+	var total, pass, fail int
+	for _, m := range w.manifests {
+		r := w.results[m]
+		total += r.Total
+		pass += r.Pass
+		fail += r.Fail
+	}
+	fmt.Fprintf(w.out, "Total: %d, Pass: %d, Fail: %d\n", total, pass, fail)
+	fmt.Fprintf(w.out, "Watching %d manifest(s) for changes...\n", len(w.manifests))
+	return nil
+}
+
+// report writes the results of a manifest. The full results are written for the first run,
+// and only the test cases whose status changed are written for the following runs.
+func (w *watcher) report(m ManifestReport) {
+	prev, ok := w.results[m.Path]
+	w.results[m.Path] = m
+	if !ok {
+		writeManifestText(w.out, m, w.verbose)
+		return
+	}
+	writeManifestDiff(w.out, prev, m)
+}
+
+// writeManifestDiff writes the test cases whose status changed between the two results of a manifest.
+func writeManifestDiff(out io.Writer, prev, cur ManifestReport) {
+	before := caseStatuses(prev)
+	after := caseStatuses(cur)
+	previous := map[string]string{}
+	for _, b := range before {
+		previous[b.key] = b.status
+	}
+
+	lines := []string{fmt.Sprintf("[%s]", cur.Path)}
+	for _, s := range after {
+		old, ok := previous[s.key]
+		if !ok {
+			old = "NEW"
+		}
+		delete(previous, s.key)
+		if old == s.status {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s -> %s", old, s.line))
+		for _, d := range s.details {
+			lines = append(lines, "--- "+d)
+		}
+	}
+	for _, b := range before {
+		if status, ok := previous[b.key]; ok {
+			lines = append(lines, fmt.Sprintf("%s -> REMOVED: %s", status, b.key))
+		}
+	}
+	if len(lines) == 1 {
+		lines = append(lines, "No status changes")
+	}
+	lines = append(lines, fmt.Sprintf("Total: %d, Pass: %d, Fail: %d\n", cur.Total, cur.Pass, cur.Fail))
+	fmt.Fprintln(out, strings.Join(lines, "\n"))
+}
+
+// caseStatus is the status of a test case, a policy or a manifest compared between runs.
+type caseStatus struct {
+	// key identifies the entry between runs, e.g. "policy - (CREATE) Deployment:foo".
+	key string
+	// status is PASS or FAIL.
+	status string
+	// line is the summary of the entry, e.g. "PASS: policy - (CREATE) Deployment:foo - ADMIT ==> ADMIT".
+	line    string
+	details []string
+}
+
+func caseStatuses(m ManifestReport) []caseStatus {
+	if m.Error != "" {
+		return []caseStatus{{key: "manifest", status: "FAIL", line: "FAIL: " + m.Error}}
+	}
+	var out []caseStatus
+	seen := map[string]int{}
+	for _, s := range m.Suites {
+		if s.Error != "" {
+			out = append(out, caseStatus{key: s.Policy, status: "FAIL", line: fmt.Sprintf("FAIL: %s ==> %s", s.Policy, strings.ToUpper(s.Error))})
+			continue
+		}
+		for _, c := range s.Cases {
+			key := s.Policy + " - " + c.Name
+			// Distinguish the test cases with the same name in a suite by their occurrence.
+			if n := seen[key]; n > 0 {
+				seen[key]++
+				key = fmt.Sprintf("%s #%d", key, n+1)
+			} else {
+				seen[key] = 1
+			}
+			status := caseStatus{key: key, status: "PASS", line: summaryLine(c.Pass, s.Policy, c)}
+			if !c.Pass {
+				status.status = "FAIL"
+				status.details = caseDetailLines(c)
+			}
+			out = append(out, status)
+		}
+	}
+	return out
+}
+
+func statFiles(files []string) map[string]fileStamp {
+	out := make(map[string]fileStamp, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			// Files which cannot be accessed are treated as missing.
+			out[f] = fileStamp{}
+			continue
+		}
+		out[f] = fileStamp{exists: true, size: info.Size(), modTime: info.ModTime()}
+	}
+	return out
+}
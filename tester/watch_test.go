@@ -0,0 +1,153 @@
+/*
+Copyright 2024 Preferred Networks, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tester
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyTestdata copies the files under testdata into dir.
+func copyTestdata(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		buf, err := os.ReadFile(filepath.Join("testdata", name))
+		mustNil(t, err)
+		mustNil(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+		mustNil(t, os.WriteFile(filepath.Join(dir, name), buf, 0o644))
+	}
+}
+
+// touch rewrites the file with the replacer and moves its modification time forward.
+func touch(t *testing.T, path string, r *strings.Replacer) {
+	t.Helper()
+	buf, err := os.ReadFile(path)
+	mustNil(t, err)
+	mustNil(t, os.WriteFile(path, []byte(r.Replace(string(buf))), 0o644))
+	future := time.Now().Add(time.Hour)
+	mustNil(t, os.Chtimes(path, future, future))
+}
+
+func TestWatcher_Poll(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	copyTestdata(t, dir,
+		"vap-standard-resources.yaml",
+		"vap-standard-resources.test/kaptest.yaml",
+		"vap-standard-resources.test/resources.yaml",
+		"vap-with-params.yaml",
+		"vap-with-params.test/kaptest.yaml",
+		"vap-with-params.test/resources.yaml",
+	)
+	var out bytes.Buffer
+	w := newWatcher(CmdConfig{}, []string{dir}, &out)
+
+	// The first run reports all the results.
+	mustNil(t, w.poll())
+	if got := out.String(); !strings.Contains(got, "Total: 14, Pass: 14, Fail: 0") || strings.Count(got, "PASS: ") != 14 {
+		t.Fatalf("unexpected output of the first run:\n%s", got)
+	}
+
+	// Nothing is run without changes.
+	out.Reset()
+	mustNil(t, w.poll())
+	if out.Len() != 0 {
+		t.Fatalf("unexpected output without changes:\n%s", out.String())
+	}
+
+	// Only the manifest loading the changed policy is run, and the changed cases are reported.
+	touch(t, filepath.Join(dir, "vap-standard-resources.yaml"), strings.NewReplacer("object.spec.replicas <= 5", "object.spec.replicas <= 100"))
+	mustNil(t, w.poll())
+	got := out.String()
+	for _, want := range []string{
+		"1 manifest(s) changed",
+		"PASS -> FAIL: deployment-replicas - (CREATE) Deployment:bad - DENY ==> ADMIT",
+		"Total: 14, Pass: 11, Fail: 3",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("output does not contain %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "vap-with-params.test") {
+		t.Errorf("unaffected manifest is run:\n%s", got)
+	}
+
+	// Removed manifests are reported.
+	out.Reset()
+	mustNil(t, os.Remove(filepath.Join(dir, "vap-with-params.test", "kaptest.yaml")))
+	mustNil(t, w.poll())
+	if got := out.String(); !strings.Contains(got, "REMOVED") || !strings.Contains(got, "Total: 12, Pass: 9, Fail: 3") {
+		t.Errorf("unexpected output after removing a manifest:\n%s", got)
+	}
+}
+
+func TestWatch_InvalidConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		cfg     CmdConfig
+		wantErr string
+	}{
+		{name: "err: output format", cfg: CmdConfig{Outputs: []string{"json"}}, wantErr: `output format "json" is not supported in the watch mode`},
+		{name: "err: changed since", cfg: CmdConfig{ChangedSince: "origin/main"}, wantErr: "--changed-since cannot be used in the watch mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if err := Watch(context.Background(), tt.cfg, []string{"testdata"}); err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Watch() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteManifestDiff(t *testing.T) {
+	t.Parallel()
+	prev := ManifestReport{Path: "kaptest.yaml", Suites: []SuiteReport{{
+		Policy: "policy",
+		Cases: []CaseReport{
+			{Name: "(CREATE) Deployment:a", Expect: Admit, Result: ResultAdmit, Pass: true},
+			{Name: "(CREATE) Deployment:b", Expect: Admit, Result: ResultAdmit, Pass: true},
+		},
+	}}}
+	cur := ManifestReport{Path: "kaptest.yaml", Suites: []SuiteReport{{
+		Policy: "policy",
+		Cases: []CaseReport{
+			{Name: "(CREATE) Deployment:a", Expect: Admit, Result: ResultAdmit, Pass: true},
+			{Name: "(CREATE) Deployment:c", Expect: Admit, Result: ResultDeny, Decisions: []DecisionReport{{Evaluation: ResultDeny, Message: "denied"}}},
+		},
+	}}}
+	cur.count()
+
+	var out bytes.Buffer
+	writeManifestDiff(&out, prev, cur)
+	want := `[kaptest.yaml]
+NEW -> FAIL: policy - (CREATE) Deployment:c - ADMIT ==> DENY
+--- DENY: reason "", message "denied"
+PASS -> REMOVED: policy - (CREATE) Deployment:b
+Total: 2, Pass: 1, Fail: 1
+
+`
+	if got := out.String(); got != want {
+		t.Errorf("writeManifestDiff() = %q, want %q", got, want)
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sync"
 
 	v1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
@@ -56,13 +57,37 @@ type ValidationParams struct {
 	ParamObj     runtime.Object
 	NamespaceObj *corev1.Namespace
 	UserInfo     user.Info
+	// Request overrides the attributes of the request derived from the objects if set,
+	// e.g. to replay a request recorded in an AdmissionReview.
+	Request *RequestAttributes
+}
+
+// RequestAttributes is the attributes of an admission request other than the objects and the user.
+type RequestAttributes struct {
+	Operation   admission.Operation
+	Kind        schema.GroupVersionKind
+	Resource    schema.GroupVersionResource
+	SubResource string
+	Namespace   string
+	Name        string
+	// Options is the options of the operation, e.g. CreateOptions.
+	Options runtime.Object
+	DryRun  bool
+	// VersionedKind and VersionedResource are the kind and the resource which the policy matched
+	// when the request is converted to another version under matchPolicy: Equivalent.
+	// The objects must be in this version. Kind and Resource are used if empty.
+	VersionedKind     schema.GroupVersionKind
+	VersionedResource schema.GroupVersionResource
 }
 
 func (p ValidationParams) Operation() admission.Operation {
-	if p.Object != nil && p.OldObject != nil {
+	if p.Request != nil && p.Request.Operation != "" {
+		return p.Request.Operation
+	}
+	if !isNil(p.Object) && !isNil(p.OldObject) {
 		return admission.Update
 	}
-	if p.Object != nil {
+	if !isNil(p.Object) {
 		return admission.Create
 	}
 	return admission.Delete
@@ -74,24 +99,28 @@ func NewValidator(policy *v1.ValidatingAdmissionPolicy) *Validator {
 	return &Validator{validator: v, policy: policy, matcher: m}
 }
 
+// strictCost is whether the strict cost calculation of CEL expressions is enforced.
+// NOTE: StrictCost option is disabled for now.
+const strictCost = false
+
+// baseEnvSet returns the base CEL environment shared by all compilations.
+// The composition environment extended from it is created per policy since the variables of the policy are added to it.
+var baseEnvSet = sync.OnceValue(func() *environment.EnvSet {
+	return environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion(), strictCost)
+})
+
 // Original: https://github.com/kubernetes/kubernetes/blob/8bd6c10ba5833369fb6582587b77de8f8b51c371/staging/src/k8s.io/apiserver/pkg/admission/plugin/policy/validating/plugin.go#L121-L157
 func compilePolicy(policy *v1.ValidatingAdmissionPolicy) (validating.Validator, matchconditions.Matcher) {
 	hasParam := false
 	if policy.Spec.ParamKind != nil {
 		hasParam = true
 	}
-	// NOTE: StrictCost option is disabled for now.
-	optionalVars := cel.OptionalVariableDeclarations{HasParams: hasParam, HasAuthorizer: true, StrictCost: false}
-	expressionOptionalVars := cel.OptionalVariableDeclarations{HasParams: hasParam, HasAuthorizer: false, StrictCost: false}
+	optionalVars := cel.OptionalVariableDeclarations{HasParams: hasParam, HasAuthorizer: true, StrictCost: strictCost}
+	expressionOptionalVars := cel.OptionalVariableDeclarations{HasParams: hasParam, HasAuthorizer: false, StrictCost: strictCost}
 	failurePolicy := policy.Spec.FailurePolicy
 	var matcher matchconditions.Matcher = nil
 	matchConditions := policy.Spec.MatchConditions
-	compositionEnvTemplate, err := cel.NewCompositionEnv(cel.VariablesTypeName, environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion(), false))
-	if err != nil {
-		panic(err)
-	}
-	filterCompiler := cel.NewCompositedCompilerFromTemplate(compositionEnvTemplate)
-	filterCompiler.CompileAndStoreVariables(convertv1beta1Variables(policy.Spec.Variables), optionalVars, environment.StoredExpressions)
+	filterCompiler := newCompositedCompiler(policy.Spec.Variables, optionalVars)
 
 	if len(matchConditions) > 0 {
 		matchExpressionAccessors := make([]cel.ExpressionAccessor, len(matchConditions))
@@ -111,6 +140,17 @@ func compilePolicy(policy *v1.ValidatingAdmissionPolicy) (validating.Validator,
 	return res, matcher
 }
 
+// newCompositedCompiler returns the compiler of the expressions in which the variables are available.
+func newCompositedCompiler(variables []v1.Variable, optionalVars cel.OptionalVariableDeclarations) *cel.CompositedCompiler {
+	compositionEnvTemplate, err := cel.NewCompositionEnv(cel.VariablesTypeName, baseEnvSet())
+	if err != nil {
+		panic(err)
+	}
+	filterCompiler := cel.NewCompositedCompilerFromTemplate(compositionEnvTemplate)
+	filterCompiler.CompileAndStoreVariables(convertv1beta1Variables(variables), optionalVars, environment.StoredExpressions)
+	return filterCompiler
+}
+
 func convertv1Validations(inputValidations []v1.Validation) []cel.ExpressionAccessor {
 	celExpressionAccessor := make([]cel.ExpressionAccessor, len(inputValidations))
 	for i, validation := range inputValidations {
@@ -193,6 +233,12 @@ func (v *Validator) Validate(p ValidationParams) (*validating.ValidateResult, er
 }
 
 func makeVersionedAttribute(p ValidationParams) (*admission.VersionedAttributes, schema.GroupVersionResource) {
+	if p.Request != nil {
+		if !p.Request.VersionedResource.Empty() {
+			return makeRequestVersionedAttribute(p), p.Request.VersionedResource
+		}
+		return makeRequestVersionedAttribute(p), p.Request.Resource
+	}
 	nameWithGVK, err := getNameWithGVK(p)
 	if err != nil {
 		return nil, schema.GroupVersionResource{}
@@ -227,6 +273,46 @@ func makeVersionedAttribute(p ValidationParams) (*admission.VersionedAttributes,
 	}, groupVersionResource
 }
 
+// makeRequestVersionedAttribute returns the attributes of the request given by p.Request.
+func makeRequestVersionedAttribute(p ValidationParams) *admission.VersionedAttributes {
+	r := p.Request
+	// Typed nils are replaced with untyped ones since the attributes compare the objects with nil.
+	var obj, oldObj runtime.Object
+	if !isNil(p.Object) {
+		obj = p.Object
+	}
+	if !isNil(p.OldObject) {
+		oldObj = p.OldObject
+	}
+	var options runtime.Object
+	if !isNil(r.Options) {
+		options = r.Options
+	}
+	versionedKind := r.VersionedKind
+	if versionedKind.Empty() {
+		versionedKind = r.Kind
+	}
+	return &admission.VersionedAttributes{
+		Attributes: admission.NewAttributesRecord(
+			obj,
+			oldObj,
+			r.Kind,
+			r.Namespace,
+			r.Name,
+			r.Resource,
+			r.SubResource,
+			p.Operation(),
+			options,
+			r.DryRun,
+			p.UserInfo,
+		),
+		VersionedOldObject: oldObj,
+		VersionedObject:    obj,
+		VersionedKind:      versionedKind,
+		Dirty:              false,
+	}
+}
+
 type nameWithGVK struct {
 	namespace string
 	name      string